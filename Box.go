@@ -1,22 +1,34 @@
 package box
 
 import (
-	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+const (
+	defaultAPIURL    = "https://api.box.com/2.0"
+	defaultUploadURL = "https://upload.box.com/api/2.0"
+	defaultOAuthURL  = "https://api.box.com/oauth2"
+	defaultAuthURL   = "https://account.box.com/api/oauth2"
+
+	// tokenAudience is the audience Box expects in JWT assertions. It stays
+	// the same when requests are routed through another host.
+	tokenAudience = "https://api.box.com/oauth2/token"
+)
+
 var (
 	errConfig = errors.New("No BoxSDK API configuration set (try 'NewConfig' or 'NewConfigFromFile')")
 )
@@ -25,6 +37,37 @@ var (
 type Config struct {
 	BoxAppSettings AppSettings `json:"boxAppSettings"`
 	EnterpriseID   string      `json:"enterpriseID"`
+
+	// SubjectType selects who server tokens are issued for: the enterprise's
+	// service account (the default) or the user with UserID.
+	SubjectType SubjectType `json:"subjectType,omitempty"`
+	UserID      string      `json:"userID,omitempty"`
+}
+
+// SubjectType is the kind of subject a server token is issued for.
+type SubjectType string
+
+// Subject types accepted by Box.
+const (
+	SubjectEnterprise SubjectType = "enterprise"
+	SubjectUser       SubjectType = "user"
+)
+
+// subject returns the subject type and ID tokens are issued for.
+func (cfg *Config) subject() (SubjectType, string, error) {
+	switch cfg.SubjectType {
+	case "", SubjectEnterprise:
+		if cfg.EnterpriseID == "" {
+			return "", "", errors.New("box: config has no enterprise ID")
+		}
+		return SubjectEnterprise, cfg.EnterpriseID, nil
+	case SubjectUser:
+		if cfg.UserID == "" {
+			return "", "", errors.New("box: config has no user ID")
+		}
+		return SubjectUser, cfg.UserID, nil
+	}
+	return "", "", fmt.Errorf("box: unknown subject type %q", cfg.SubjectType)
 }
 
 // AppSettings is the structure of the configuration information.
@@ -49,79 +92,217 @@ type AccessTokenObject struct {
 	RefreshToken    string `json:"refresh_token"`
 	RestrictedTo    []struct {
 		Scope  string      `json:"scope,omitempty"`
-		Object *FileObject `json:"object,omitempty`
+		Object *FileObject `json:"object,omitempty"`
 	} `json:"restricted_to,omitempty"`
 	TokenType string `json:"token_type,omitempty"`
+
+	// Expiry is when the token expires. It is set by the SDK when the token
+	// is issued.
+	Expiry time.Time `json:"expiry,omitempty"`
 }
 
-// httpResponse is a structure for capturing data from not OK http statuses.
-type httpResponse struct {
-	Type        string `json:"type"`
-	Status      int    `json:"status"`
-	Code        string `json:"code"`
-	ContextInfo struct {
-		Conflicts struct {
-			Type        string `json:"type"`
-			ID          string `json:"id"`
-			FileVersion struct {
-				Type string `json:"type"`
-				ID   string `json:"id"`
-				Sha1 string `json:"sha1"`
-			} `json:"file_version"`
-			SequenceID string `json:"sequence_id"`
-			Etag       string `json:"etag"`
-			Sha1       string `json:"sha1"`
-			Name       string `json:"name"`
-		} `json:"conflicts"`
-	} `json:"context_info"`
-	HelpURL   string `json:"help_url"`
-	Message   string `json:"message"`
-	RequestID string `json:"request_id"`
+// Endpoints are the base URLs the SDK sends its requests to. Empty fields fall
+// back to the public Box endpoints.
+type Endpoints struct {
+	API    string // e.g. https://api.box.com/2.0
+	Upload string // e.g. https://upload.box.com/api/2.0
+	OAuth  string // e.g. https://api.box.com/oauth2
+
+	// Authorize is where users are sent to grant access to an OAuth 2.0 app,
+	// e.g. https://account.box.com/api/oauth2
+	Authorize string
+}
+
+// Logger is the interface the SDK writes its request log to. A *log.Logger
+// satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
 }
 
 // SDK is the structure for establishing the connection to the Box API.
 type SDK struct {
-	access *AccessTokenObject
-	config *Config
-	client *http.Client
+	tokens    TokenSource
+	store     TokenStore
+	users     *userTokens
+	config    *Config
+	client    *http.Client
+	endpoints Endpoints
+	logger    Logger
+	retry     RetryPolicy
+	headers   map[string]string
+
+	// asUser is the ID of the user authenticated calls are made on behalf
+	// of, set by AsUser.
+	asUser string
+
+	uploadWorkers   int
+	uploadPreflight bool
+}
+
+// SetLogger sets the logger requests are reported to. By default nothing is
+// logged.
+func (sdk *SDK) SetLogger(logger Logger) {
+	sdk.logger = logger
+}
+
+// logf writes to the SDK's logger, if one is set.
+func (sdk *SDK) logf(format string, v ...interface{}) {
+	if sdk.logger != nil {
+		sdk.logger.Printf(format, v...)
+	}
+}
+
+// SetEndpoints routes all requests through the given base URLs, such as an
+// egress proxy, a regional endpoint or a local stand-in.
+func (sdk *SDK) SetEndpoints(endpoints Endpoints) {
+	sdk.endpoints = endpoints
+}
+
+// baseURL returns url without a trailing slash, or def if url is empty.
+func baseURL(url, def string) string {
+	if url == "" {
+		return def
+	}
+	return strings.TrimSuffix(url, "/")
+}
+
+// fileURL is the base URL for the files API.
+func (sdk *SDK) fileURL() string {
+	return baseURL(sdk.endpoints.API, defaultAPIURL) + "/files/"
+}
+
+// folderURL is the base URL for the folders API.
+func (sdk *SDK) folderURL() string {
+	return baseURL(sdk.endpoints.API, defaultAPIURL) + "/folders/"
+}
+
+// uploadURL is the URL new files are uploaded to.
+func (sdk *SDK) uploadURL() string {
+	return baseURL(sdk.endpoints.Upload, defaultUploadURL) + "/files/content"
+}
+
+// tokenURL is the URL access tokens are requested from.
+func (sdk *SDK) tokenURL() string {
+	return baseURL(sdk.endpoints.OAuth, defaultOAuthURL) + "/token"
 }
 
 // NewConfig sets the configuration for the SDK to establish it's connection.
 func (sdk *SDK) NewConfig(cfg *Config) {
 	sdk.config = cfg
 	sdk.client = &http.Client{}
+	sdk.useTokens(sdk.jwtToken)
+	sdk.users = &userTokens{grant: sdk.jwtAssertionToken}
 }
 
-// NewConfigFromFile sets the config file to read Box info from.
+// NewConfigFromFile sets the config file to read Box info from. The config
+// is validated as by ReadConfigFile.
 func (sdk *SDK) NewConfigFromFile(filename string) error {
-	content, err := ioutil.ReadFile(filename)
+	cfg, err := ReadConfigFile(filename)
 	if err != nil {
-		log.Fatal(err)
 		return err
 	}
 
-	err = json.Unmarshal(content, &sdk.config)
+	sdk.NewConfig(cfg)
+	return nil
+}
+
+// request runs an authenticated HTTP request to the Box API.
+func (sdk *SDK) request(ctx context.Context, method string, url string, body io.Reader, headers map[string]string) ([]byte, error) {
+	return sdk.call(ctx, method, url, body, headers, true)
+}
+
+// call runs an HTTP request to the Box API and returns the response body.
+// When auth is set the request carries an access token.
+func (sdk *SDK) call(ctx context.Context, method string, url string, body io.Reader, headers map[string]string, auth bool) ([]byte, error) {
+	response, err := sdk.do(ctx, method, url, body, headers, auth)
 	if err != nil {
-		log.Fatal(err)
-		return err
+		return nil, err
 	}
+	defer response.Body.Close()
 
-	sdk.client = &http.Client{}
-	return nil
+	respBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("box: reading response from %s: %w", url, err)
+	}
+	return respBytes, nil
 }
 
-// request runs an HTTP request to the Box API.
-func (sdk *SDK) request(method string, url string, body io.Reader, headers map[string]string) ([]byte, error) {
-	if sdk.config == nil {
+// do runs an HTTP request to the Box API, retrying it according to the SDK's
+// RetryPolicy, and returns the successful response with its body unread.
+// When auth is set the request carries an access token, and is
+// re-authenticated once if Box rejects the token.
+func (sdk *SDK) do(ctx context.Context, method string, url string, body io.Reader, headers map[string]string, auth bool) (*http.Response, error) {
+	if sdk.config == nil || (auth && sdk.tokens == nil) {
 		return nil, errConfig
 	}
 
-	request, err := http.NewRequest(method, url, body)
+	nextBody, err := replayBody(body, sdk.retry.MaxAttempts > 1)
 	if err != nil {
-		log.Fatalln(err)
 		return nil, err
 	}
 
+	reauthenticated := false
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		reqBody, err := nextBody()
+		if errors.Is(err, errNotReplayable) && lastErr != nil {
+			return nil, lastErr
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var token *AccessTokenObject
+		if auth {
+			if token, err = sdk.tokens.Token(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		response, err := sdk.send(ctx, method, url, reqBody, headers, token)
+		if err == nil {
+			return response, nil
+		}
+		lastErr = err
+
+		// Fetch a new token once if the current one was rejected.
+		if ts, ok := sdk.tokens.(tokenInvalidator); ok && auth && !reauthenticated &&
+			hasStatus(err, http.StatusUnauthorized) {
+			ts.invalidate(token)
+			reauthenticated = true
+			attempt--
+			continue
+		}
+
+		delay, retry := sdk.retry.retryDelay(method, attempt, err)
+		if !retry {
+			return nil, err
+		}
+		sdk.logf("box: retrying %s %s in %s: %v", method, url, delay, err)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send makes a single attempt at an HTTP request to the Box API. The body of
+// a successful response is left for the caller to read and close.
+func (sdk *SDK) send(ctx context.Context, method string, url string, body io.Reader, headers map[string]string, token *AccessTokenObject) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("box: building request: %w", err)
+	}
+	if b, ok := body.(*sizedBody); ok {
+		request.ContentLength = b.size
+		if b.size == 0 {
+			request.Body = http.NoBody
+		}
+	}
+
+	for k, v := range sdk.headers {
+		request.Header.Set(k, v)
+	}
+
 	// Add all user specified headers to the request header.
 	if headers != nil {
 		for k, v := range headers {
@@ -129,43 +310,135 @@ func (sdk *SDK) request(method string, url string, body io.Reader, headers map[s
 		}
 	}
 
-	// Check if we have a valid access token object.
-	if sdk.access != nil {
-		request.Header.Add("Authorization", "Bearer "+sdk.access.AccessToken)
+	if token != nil {
+		request.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		if sdk.asUser != "" {
+			request.Header.Set("As-User", sdk.asUser)
+		}
 	}
 
 	response, err := sdk.client.Do(request)
 	if err != nil {
-		log.Fatalln(err)
-		return nil, err
+		return nil, fmt.Errorf("box: %s %s: %w", method, url, err)
 	}
-	defer response.Body.Close()
-
-	respBytes, err := ioutil.ReadAll(response.Body)
-	response.Body.Close()
 
-	log.Println("URL    :", url)
-	log.Println("Status :", response.Status)
+	sdk.logf("box: %s %s: %s", method, url, response.Status)
 
 	if response.StatusCode >= http.StatusBadRequest {
-		var status httpResponse
-		json.Unmarshal(respBytes, &status)
-		return nil, errors.New(status.Type + " " + strconv.Itoa(status.Status) + " (" + status.Code + ") " + "\"" + status.Message + "\"")
+		defer response.Body.Close()
+		respBytes, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return nil, fmt.Errorf("box: reading response from %s: %w", url, err)
+		}
+		return nil, newAPIError(response, respBytes)
 	}
-	return respBytes, nil
+	return response, nil
+}
+
+// unmarshal decodes the JSON body of a successful response into v.
+func unmarshal(response []byte, v interface{}) error {
+	if err := json.Unmarshal(response, v); err != nil {
+		return fmt.Errorf("box: parsing response: %w", err)
+	}
+	return nil
 }
 
-// RequestAccessToken requests a valid access token from the Box API.
+// RequestAccessToken requests a new access token from the Box API. Tokens are
+// otherwise requested lazily and refreshed shortly before they expire.
 func (sdk *SDK) RequestAccessToken() error {
-	if sdk.config == nil {
+	return sdk.RequestAccessTokenContext(context.Background())
+}
+
+// RequestAccessTokenContext is like RequestAccessToken but uses ctx for its
+// requests.
+func (sdk *SDK) RequestAccessTokenContext(ctx context.Context) error {
+	if sdk.config == nil || sdk.tokens == nil {
 		return errConfig
 	}
+	var err error
+	if ts, ok := sdk.tokens.(tokenInvalidator); ok {
+		_, err = ts.refresh(ctx)
+	} else {
+		_, err = sdk.tokens.Token(ctx)
+	}
+	return err
+}
+
+// AsUser returns a copy of the SDK that makes every call on behalf of the
+// user with the given ID by sending the As-User header. The SDK keeps its own
+// token, which must belong to an admin or a service account allowed to
+// impersonate users. The original SDK is not affected.
+func (sdk *SDK) AsUser(userID string) *SDK {
+	user := *sdk
+	user.asUser = userID
+	return &user
+}
+
+// ForUser returns a copy of the SDK that authenticates as the app user or
+// managed user with the given ID, using the JWT or Client Credentials grant
+// the SDK was configured with. Token sources are cached per user and shared
+// by every copy made for that user.
+func (sdk *SDK) ForUser(userID string) (*SDK, error) {
+	if sdk.config == nil {
+		return nil, errConfig
+	}
+	if sdk.users == nil {
+		return nil, errors.New("box: ForUser requires JWT or Client Credentials authentication")
+	}
+	user := *sdk
+	user.tokens = sdk.users.source(userID, func(ctx context.Context, _ *AccessTokenObject) (*AccessTokenObject, error) {
+		return sdk.users.grant(ctx, SubjectUser, userID)
+	})
+	return &user, nil
+}
+
+// userTokens caches the token sources of the users an SDK acts as, which
+// request tokens with grant.
+type userTokens struct {
+	grant   func(ctx context.Context, subjectType SubjectType, subjectID string) (*AccessTokenObject, error)
+	mu      sync.Mutex
+	sources map[string]TokenSource
+}
+
+// source returns the token source for userID, creating it with fetch.
+func (u *userTokens) source(userID string, fetch tokenFetcher) TokenSource {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.sources == nil {
+		u.sources = make(map[string]TokenSource)
+	}
+	ts, ok := u.sources[userID]
+	if !ok {
+		ts = newCachedTokenSource(fetch)
+		u.sources[userID] = ts
+	}
+	return ts
+}
+
+// jwtToken requests a new access token for the configured subject using the
+// JWT grant.
+func (sdk *SDK) jwtToken(ctx context.Context, _ *AccessTokenObject) (*AccessTokenObject, error) {
+	if sdk.config == nil {
+		return nil, errConfig
+	}
+	subjectType, subjectID, err := sdk.config.subject()
+	if err != nil {
+		return nil, err
+	}
+	return sdk.jwtAssertionToken(ctx, subjectType, subjectID)
+}
+
+// jwtAssertionToken requests a new access token for a subject using the JWT
+// grant.
+func (sdk *SDK) jwtAssertionToken(ctx context.Context, subjectType SubjectType, subjectID string) (*AccessTokenObject, error) {
+	if sdk.config == nil {
+		return nil, errConfig
+	}
 	// Create a unique 32 character long string.
 	rBytes := make([]byte, 32)
 	_, err := rand.Read(rBytes)
 	if err != nil {
-		log.Fatalln(err)
-		return err
+		return nil, fmt.Errorf("box: generating jti: %w", err)
 	}
 
 	jti := base64.URLEncoding.EncodeToString(rBytes)
@@ -177,34 +450,24 @@ func (sdk *SDK) RequestAccessToken() error {
 	// Construct claims.
 	claims := token.Claims.(jwt.MapClaims)
 	claims["iss"] = sdk.config.BoxAppSettings.ClientID
-	claims["sub"] = sdk.config.EnterpriseID
-	claims["box_sub_type"] = "enterprise"
-	claims["aud"] = "https://api.box.com/oauth2/token"
+	claims["sub"] = subjectID
+	claims["box_sub_type"] = string(subjectType)
+	claims["aud"] = tokenAudience
 	claims["jti"] = jti
 	claims["exp"] = time.Now().Add(time.Second * 3).Unix()
 
 	// Decrypt the PrivateKey using its passphrase.
-	signedKey, err := jwt.ParseRSAPrivateKeyFromPEMWithPassword(
-		[]byte(sdk.config.BoxAppSettings.AppAuth.PrivateKey),
-		sdk.config.BoxAppSettings.AppAuth.Passphrase,
-	)
-
+	signedKey, err := sdk.config.privateKey()
 	if err != nil {
-		log.Fatalln(err)
-		return err
+		return nil, err
 	}
 
 	// Build the assertion from the signedKey and claims.
 	assertion, err := token.SignedString(signedKey)
-
 	if err != nil {
-		log.Fatalln(err)
-		return err
+		return nil, fmt.Errorf("box: signing assertion: %w", err)
 	}
 
-	// Build header
-	header := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
-
 	// Build the access token request.
 	payload := url.Values{}
 	payload.Add("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
@@ -212,26 +475,5 @@ func (sdk *SDK) RequestAccessToken() error {
 	payload.Add("client_id", sdk.config.BoxAppSettings.ClientID)
 	payload.Add("client_secret", sdk.config.BoxAppSettings.ClientSecret)
 
-	// Post the request to the Box API.
-	response, err := sdk.request("POST", "https://api.box.com/oauth2/token", bytes.NewBufferString(payload.Encode()), header)
-	if err != nil {
-		log.Fatalln(err)
-		return err
-	}
-
-	// Set the access token.
-	err = json.Unmarshal(response, &sdk.access)
-	if err != nil {
-		log.Fatalln(err)
-		return err
-	}
-
-	go func() {
-		for range time.Tick(time.Hour) {
-			sdk.RequestAccessToken()
-		}
-	}()
-	time.Sleep(time.Nanosecond)
-
-	return nil
+	return sdk.requestToken(ctx, payload)
 }
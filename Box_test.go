@@ -1,33 +1,286 @@
 package box
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/ghostofcookie/gobox/boxtest"
 )
 
 // setup is a setup function used by some tests to ensure valid configuration.
-var setup func() *SDK
+// It returns an SDK pointed at a fresh fake Box API, which the caller closes.
+var setup func() (*SDK, *boxtest.Server)
 
 func TestMain(m *testing.M) {
 	log.SetOutput(os.Stdout)
 
-	setup = func() *SDK {
+	setup = func() (*SDK, *boxtest.Server) {
+		srv := boxtest.NewServer()
+		srv.ClientID = "client-id"
+		srv.ClientSecret = "client-secret"
+
 		sdk := new(SDK)
 		sdk.NewConfig(&Config{
 			BoxAppSettings: AppSettings{
-				ClientID:     os.Getenv("CLIENT_ID"),
-				ClientSecret: os.Getenv("CLIENT_SECRET"),
+				ClientID:     srv.ClientID,
+				ClientSecret: srv.ClientSecret,
 				AppAuth: AppAuth{
-					PublicKeyID: os.Getenv("PUBLIC_KEY_ID"),
-					PrivateKey:  os.Getenv("PRIVATE_KEY"),
-					Passphrase:  os.Getenv("PASSPHRASE"),
+					PublicKeyID: boxtest.PublicKeyID,
+					PrivateKey:  boxtest.PrivateKey(),
+					Passphrase:  boxtest.Passphrase,
 				},
 			},
-			EnterpriseID: os.Getenv("ENTERPRISE_ID"),
+			EnterpriseID: "enterprise-id",
 		})
-		return sdk
+		sdk.SetEndpoints(Endpoints{
+			API:    srv.APIURL(),
+			Upload: srv.UploadURL(),
+			OAuth:  srv.OAuthURL(),
+		})
+		return sdk, srv
 	}
 
 	os.Exit(m.Run())
 }
+
+func TestRequestAccessToken(t *testing.T) {
+	t.Run("TestInvalidConfig", func(t *testing.T) {
+		sdk := new(SDK)
+		if err := sdk.RequestAccessToken(); err != errConfig {
+			t.Error("Expected config to be invalid")
+		}
+	})
+
+	t.Run("TestValidConfig", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		if err := sdk.RequestAccessToken(); err != nil {
+			t.Fatal("Expected an access token, got", err)
+		}
+		token, err := sdk.tokens.Token(context.Background())
+		if err != nil || token.AccessToken == "" || token.Expiry.IsZero() {
+			t.Error("Expected access token to be set")
+		}
+	})
+}
+
+func TestSetEndpoints(t *testing.T) {
+	t.Run("TestDefaults", func(t *testing.T) {
+		sdk := new(SDK)
+		if sdk.fileURL() != "https://api.box.com/2.0/files/" ||
+			sdk.uploadURL() != "https://upload.box.com/api/2.0/files/content" ||
+			sdk.tokenURL() != "https://api.box.com/oauth2/token" {
+			t.Error("Expected the public Box endpoints by default")
+		}
+	})
+
+	t.Run("TestTrailingSlash", func(t *testing.T) {
+		sdk := new(SDK)
+		sdk.SetEndpoints(Endpoints{API: "https://proxy.example.com/box/2.0/"})
+		if got := sdk.folderURL(); got != "https://proxy.example.com/box/2.0/folders/" {
+			t.Error("Unexpected folder URL", got)
+		}
+	})
+
+	t.Run("TestRewrittenHost", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.SetEndpoints(Endpoints{})
+		sdk.client = srv.Client()
+		if err := sdk.RequestAccessToken(); err != nil {
+			t.Fatal("Expected an access token, got", err)
+		}
+		if _, err := sdk.GetFolderInfo("0"); err != nil {
+			t.Error("Expected to receive Folder info, got", err)
+		}
+	})
+}
+
+// recordLogger collects formatted log lines.
+type recordLogger struct {
+	lines []string
+}
+
+func (l *recordLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestSetLogger(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	logger := &recordLogger{}
+	sdk.SetLogger(logger)
+	sdk.RequestAccessToken()
+	sdk.GetFolderInfo("0")
+
+	if len(logger.lines) != 2 || !strings.Contains(logger.lines[1], "GET "+srv.APIURL()+"/folders/0: 200 OK") {
+		t.Errorf("Expected one line per request, got %q", logger.lines)
+	}
+}
+
+func TestNewConfigFromFile(t *testing.T) {
+	sdk := new(SDK)
+	err := sdk.NewConfigFromFile("missing.json")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a wrapped not-exist error, got", err)
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	if err := sdk.RequestAccessToken(); err != nil {
+		t.Fatal("Expected an access token, got", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := sdk.GetFolderInfoContext(ctx, "0"); !errors.Is(err, context.Canceled) {
+		t.Error("Expected the request to be canceled, got", err)
+	}
+	if err := sdk.RequestAccessTokenContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Error("Expected the token request to be canceled, got", err)
+	}
+}
+
+func TestForUser(t *testing.T) {
+	t.Run("TestInvalidConfig", func(t *testing.T) {
+		sdk := new(SDK)
+		if _, err := sdk.ForUser("42"); err != errConfig {
+			t.Error("Expected config to be invalid")
+		}
+	})
+
+	t.Run("TestUserToken", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		user, err := sdk.ForUser("42")
+		if err != nil {
+			t.Fatal("Expected an SDK for user 42, got", err)
+		}
+		if _, err := user.GetFolderInfo("0"); err != nil {
+			t.Fatal("Expected to receive Folder info, got", err)
+		}
+		token, _ := user.tokens.Token(context.Background())
+		if got := srv.TokenSubject(token.AccessToken); got != "user:42" {
+			t.Error("Expected a token for user 42, got", got)
+		}
+
+		enterprise, _ := sdk.tokens.Token(context.Background())
+		if got := srv.TokenSubject(enterprise.AccessToken); got != "enterprise:enterprise-id" {
+			t.Error("Expected the original SDK to keep its enterprise token, got", got)
+		}
+	})
+
+	t.Run("TestCachedPerUser", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		for _, id := range []string{"42", "42", "43"} {
+			user, err := sdk.ForUser(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			user.GetFolderInfo("0")
+		}
+		if got := srv.TokenRequests(); got != 2 {
+			t.Errorf("Expected one token per user, got %d token requests", got)
+		}
+	})
+
+	t.Run("TestClientCredentials", func(t *testing.T) {
+		srv := boxtest.NewServer()
+		defer srv.Close()
+		sdk, err := NewClient(ClientCredentialsAuth(&Config{
+			BoxAppSettings: AppSettings{ClientID: "client-id", ClientSecret: "client-secret"},
+			EnterpriseID:   "enterprise-id",
+		}), WithEndpoints(Endpoints{API: srv.APIURL(), OAuth: srv.OAuthURL()}))
+		if err != nil {
+			t.Fatal("Expected an SDK, got", err)
+		}
+		user, err := sdk.ForUser("42")
+		if err != nil {
+			t.Fatal("Expected an SDK for user 42, got", err)
+		}
+		if _, err := user.GetFolderInfo("0"); err != nil {
+			t.Fatal("Expected to receive Folder info, got", err)
+		}
+		token, _ := user.tokens.Token(context.Background())
+		if got := srv.TokenSubject(token.AccessToken); got != "user:42" {
+			t.Error("Expected a token for user 42, got", got)
+		}
+	})
+
+	t.Run("TestUnsupportedAuth", func(t *testing.T) {
+		cfg := &Config{BoxAppSettings: AppSettings{ClientID: "client-id", ClientSecret: "client-secret"}}
+		sdk, err := NewClient(OAuth2Auth(cfg, &AccessTokenObject{AccessToken: "token", ExpiresIn: 3600}))
+		if err != nil {
+			t.Fatal("Expected an SDK, got", err)
+		}
+		if _, err := sdk.ForUser("42"); err == nil || err == errConfig {
+			t.Error("Expected ForUser to require JWT or Client Credentials, got", err)
+		}
+	})
+
+	t.Run("TestConfigSubject", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.config.SubjectType = SubjectUser
+		sdk.config.UserID = "7"
+		sdk.RequestAccessToken()
+		token, _ := sdk.tokens.Token(context.Background())
+		if got := srv.TokenSubject(token.AccessToken); got != "user:7" {
+			t.Error("Expected a token for user 7, got", got)
+		}
+	})
+}
+
+func TestAsUser(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	admin := sdk.AsUser("42")
+	if _, err := admin.ListItemsInFolder("0", 10, 0); err != nil {
+		t.Fatal("Expected to list items, got", err)
+	}
+	if got := srv.LastHeader().Get("As-User"); got != "42" {
+		t.Error("Expected the As-User header, got", got)
+	}
+
+	if _, err := admin.AsUser("43").GetFolderInfo("0"); err != nil {
+		t.Fatal("Expected to receive Folder info, got", err)
+	}
+	if got := srv.LastHeader().Get("As-User"); got != "43" {
+		t.Error("Expected the As-User header to be replaced, got", got)
+	}
+
+	sdk.GetFolderInfo("0")
+	if got := srv.LastHeader().Get("As-User"); got != "" {
+		t.Error("Expected the original SDK not to impersonate, got", got)
+	}
+	if got := srv.TokenRequests(); got != 1 {
+		t.Errorf("Expected the scoped SDKs to share the token, got %d token requests", got)
+	}
+
+	if err := admin.RequestAccessToken(); err != nil {
+		t.Fatal("Expected a new access token, got", err)
+	}
+	if got := srv.LastHeader().Get("As-User"); got != "" {
+		t.Error("Expected the token request not to impersonate, got", got)
+	}
+	if _, err := admin.ExchangeToken([]string{"item_preview"}, ""); err != nil {
+		t.Fatal("Expected a downscoped token, got", err)
+	}
+	if got := srv.LastHeader().Get("As-User"); got != "" {
+		t.Error("Expected the token exchange not to impersonate, got", got)
+	}
+	if err := admin.RevokeToken(); err != nil {
+		t.Fatal("Expected the token to be revoked, got", err)
+	}
+	if got := srv.LastHeader().Get("As-User"); got != "" {
+		t.Error("Expected the revoke request not to impersonate, got", got)
+	}
+}
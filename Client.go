@@ -0,0 +1,187 @@
+package box
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Auth sets up how a client created by NewClient authenticates.
+type Auth func(sdk *SDK) error
+
+// JWTAuth authenticates with the JWT grant, signing assertions with the
+// config's key pair. The config is validated up front.
+func JWTAuth(cfg *Config) Auth {
+	return func(sdk *SDK) error {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		if cfg.BoxAppSettings.AppAuth.PrivateKey == "" {
+			return errors.New("box: config has no private key for JWT authentication")
+		}
+		sdk.config = cfg
+		sdk.useTokens(sdk.jwtToken)
+		sdk.users = &userTokens{grant: sdk.jwtAssertionToken}
+		return nil
+	}
+}
+
+// ClientCredentialsAuth authenticates with the Client Credentials Grant,
+// using only the app's client ID and secret. Tokens are issued for the
+// subject selected by cfg.SubjectType.
+func ClientCredentialsAuth(cfg *Config) Auth {
+	return func(sdk *SDK) error {
+		if cfg.BoxAppSettings.ClientID == "" || cfg.BoxAppSettings.ClientSecret == "" {
+			return errors.New("box: config has no client ID or client secret")
+		}
+		if _, _, err := cfg.subject(); err != nil {
+			return err
+		}
+		sdk.config = cfg
+		sdk.useTokens(sdk.clientCredentialsToken)
+		sdk.users = &userTokens{grant: sdk.clientCredentialsGrant}
+		return nil
+	}
+}
+
+// OAuth2Auth authenticates as a user who granted the app access, starting
+// from token and refreshing it with the config's client credentials. token
+// may be nil when the client's TokenStore already holds one.
+func OAuth2Auth(cfg *Config, token *AccessTokenObject) Auth {
+	return func(sdk *SDK) error {
+		if cfg.BoxAppSettings.ClientID == "" || cfg.BoxAppSettings.ClientSecret == "" {
+			return errors.New("box: config has no client ID or client secret")
+		}
+		sdk.config = cfg
+		sdk.SetToken(token)
+		return nil
+	}
+}
+
+// TokenSourceAuth authenticates with tokens from ts, such as developer
+// tokens or tokens managed by another service.
+func TokenSourceAuth(ts TokenSource) Auth {
+	return func(sdk *SDK) error {
+		if ts == nil {
+			return errors.New("box: no token source")
+		}
+		sdk.config = &Config{}
+		sdk.tokens = ts
+		return nil
+	}
+}
+
+// Option configures a client created by NewClient.
+type Option func(sdk *SDK)
+
+// WithHTTPClient sends requests with client instead of a default
+// http.Client; a nil client keeps the default. Later WithTransport and
+// WithTimeout options modify a copy of it.
+func WithHTTPClient(client *http.Client) Option {
+	return func(sdk *SDK) {
+		sdk.client = client
+		if client == nil {
+			sdk.client = &http.Client{}
+		}
+	}
+}
+
+// WithTransport sends requests through rt, e.g. an instrumented transport or
+// one with a proxy.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(sdk *SDK) {
+		client := *sdk.client
+		client.Transport = rt
+		sdk.client = &client
+	}
+}
+
+// WithTimeout limits the time a single request attempt may take, including
+// reading the response body.
+func WithTimeout(timeout time.Duration) Option {
+	return func(sdk *SDK) {
+		client := *sdk.client
+		client.Timeout = timeout
+		sdk.client = &client
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return WithHeader("User-Agent", userAgent)
+}
+
+// WithHeader adds a header to every request. Headers set by individual calls
+// take precedence.
+func WithHeader(key, value string) Option {
+	return func(sdk *SDK) {
+		headers := make(map[string]string, len(sdk.headers)+1)
+		for k, v := range sdk.headers {
+			headers[k] = v
+		}
+		headers[key] = value
+		sdk.headers = headers
+	}
+}
+
+// WithEndpoints routes requests through the given base URLs, as SetEndpoints
+// does.
+func WithEndpoints(endpoints Endpoints) Option {
+	return func(sdk *SDK) {
+		sdk.SetEndpoints(endpoints)
+	}
+}
+
+// WithLogger reports requests to logger, as SetLogger does.
+func WithLogger(logger Logger) Option {
+	return func(sdk *SDK) {
+		sdk.SetLogger(logger)
+	}
+}
+
+// WithRetryPolicy retries failed requests according to policy, as
+// SetRetryPolicy does.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(sdk *SDK) {
+		sdk.SetRetryPolicy(policy)
+	}
+}
+
+// WithTokenStore persists the client's tokens in store, as SetTokenStore
+// does.
+func WithTokenStore(store TokenStore) Option {
+	return func(sdk *SDK) {
+		sdk.SetTokenStore(store)
+	}
+}
+
+// WithUploadConcurrency sets the number of parts upload sessions send at
+// once, as SetUploadConcurrency does.
+func WithUploadConcurrency(n int) Option {
+	return func(sdk *SDK) {
+		sdk.SetUploadConcurrency(n)
+	}
+}
+
+// WithUploadPreflight runs a preflight check before each upload, as
+// SetUploadPreflight does.
+func WithUploadPreflight() Option {
+	return func(sdk *SDK) {
+		sdk.SetUploadPreflight(true)
+	}
+}
+
+// NewClient returns an SDK that authenticates with auth, configured by opts.
+func NewClient(auth Auth, opts ...Option) (*SDK, error) {
+	if auth == nil {
+		return nil, errors.New("box: no authentication method")
+	}
+	sdk := &SDK{client: &http.Client{}}
+	for _, opt := range opts {
+		opt(sdk)
+	}
+	if err := auth(sdk); err != nil {
+		return nil, err
+	}
+	return sdk, nil
+}
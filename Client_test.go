@@ -0,0 +1,90 @@
+package box
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ghostofcookie/gobox/boxtest"
+)
+
+// countingTransport counts the requests it passes on.
+type countingTransport struct {
+	n int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.n, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestNewClient(t *testing.T) {
+	t.Run("TestOptions", func(t *testing.T) {
+		srv := boxtest.NewServer()
+		defer srv.Close()
+		srv.AddFolder(boxtest.RootID, "Docs")
+
+		transport := &countingTransport{}
+		sdk, err := NewClient(JWTAuth(testConfig()),
+			WithTransport(transport),
+			WithTimeout(10*time.Second),
+			WithUserAgent("gobox-test"),
+			WithHeader("X-Trace", "abc"),
+			WithRetryPolicy(DefaultRetryPolicy),
+			WithEndpoints(Endpoints{
+				API:    srv.APIURL(),
+				Upload: srv.UploadURL(),
+				OAuth:  srv.OAuthURL(),
+			}),
+		)
+		if err != nil {
+			t.Fatal("Expected a client, got", err)
+		}
+		if _, err := sdk.GetFolderInfo(boxtest.RootID); err != nil {
+			t.Fatal("Expected the request to succeed, got", err)
+		}
+		if atomic.LoadInt32(&transport.n) != 2 {
+			t.Error("Expected the token and API requests to use the transport")
+		}
+		header := srv.LastHeader()
+		if header.Get("User-Agent") != "gobox-test" || header.Get("X-Trace") != "abc" {
+			t.Error("Expected the default headers to be sent, got", header)
+		}
+		if sdk.client.Timeout != 10*time.Second || sdk.retry.MaxAttempts != DefaultRetryPolicy.MaxAttempts {
+			t.Error("Expected the timeout and retry policy to be set")
+		}
+	})
+
+	t.Run("TestHTTPClientNotModified", func(t *testing.T) {
+		client := &http.Client{}
+		sdk, err := NewClient(JWTAuth(testConfig()), WithHTTPClient(client), WithTimeout(time.Second))
+		if err != nil {
+			t.Fatal("Expected a client, got", err)
+		}
+		if client.Timeout != 0 || sdk.client.Timeout != time.Second {
+			t.Error("Expected the timeout to apply to a copy of the client")
+		}
+	})
+
+	t.Run("TestNilHTTPClient", func(t *testing.T) {
+		sdk, err := NewClient(JWTAuth(testConfig()), WithHTTPClient(nil), WithTimeout(time.Second))
+		if err != nil {
+			t.Fatal("Expected a client, got", err)
+		}
+		if sdk.client == nil || sdk.client.Timeout != time.Second {
+			t.Error("Expected a default client with the timeout, got", sdk.client)
+		}
+	})
+
+	t.Run("TestInvalidAuth", func(t *testing.T) {
+		if _, err := NewClient(nil); err == nil {
+			t.Error("Expected a client without authentication to be rejected")
+		}
+		cfg := testConfig()
+		cfg.BoxAppSettings.AppAuth.Passphrase = "wrong"
+		if _, err := NewClient(JWTAuth(cfg)); err == nil {
+			t.Error("Expected an invalid config to be rejected")
+		}
+	})
+}
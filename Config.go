@@ -0,0 +1,141 @@
+package box
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Environment variables read by ConfigFromEnv.
+const (
+	EnvClientID     = "CLIENT_ID"
+	EnvClientSecret = "CLIENT_SECRET"
+	EnvPublicKeyID  = "PUBLIC_KEY_ID"
+	EnvPrivateKey   = "PRIVATE_KEY"
+	EnvPassphrase   = "PASSPHRASE"
+	EnvEnterpriseID = "ENTERPRISE_ID"
+)
+
+// ReadConfig reads a config in the JSON format generated by the Box developer
+// console and validates it.
+func ReadConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	if err := json.NewDecoder(r).Decode(cfg); err != nil {
+		return nil, fmt.Errorf("box: parsing config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ReadConfigFile reads and validates the config file downloaded from the Box
+// developer console.
+func ReadConfigFile(filename string) (*Config, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("box: reading config: %w", err)
+	}
+	defer file.Close()
+
+	return ReadConfig(file)
+}
+
+// ConfigFromEnv builds a config from the CLIENT_ID, CLIENT_SECRET,
+// PUBLIC_KEY_ID, PRIVATE_KEY, PASSPHRASE and ENTERPRISE_ID environment
+// variables and validates it. Escaped newlines ("\n") in PRIVATE_KEY are
+// expanded.
+func ConfigFromEnv() (*Config, error) {
+	cfg := &Config{
+		BoxAppSettings: AppSettings{
+			ClientID:     os.Getenv(EnvClientID),
+			ClientSecret: os.Getenv(EnvClientSecret),
+			AppAuth: AppAuth{
+				PublicKeyID: os.Getenv(EnvPublicKeyID),
+				PrivateKey:  strings.Replace(os.Getenv(EnvPrivateKey), `\n`, "\n", -1),
+				Passphrase:  os.Getenv(EnvPassphrase),
+			},
+		},
+		EnterpriseID: os.Getenv(EnvEnterpriseID),
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that the config has the client credentials and a subject
+// to issue tokens for. If it holds a key pair for JWT authentication, the
+// private key must also decrypt with the passphrase.
+func (cfg *Config) Validate() error {
+	var missing []string
+	if cfg.BoxAppSettings.ClientID == "" {
+		missing = append(missing, "boxAppSettings.clientID")
+	}
+	if cfg.BoxAppSettings.ClientSecret == "" {
+		missing = append(missing, "boxAppSettings.clientSecret")
+	}
+
+	auth := cfg.BoxAppSettings.AppAuth
+	jwtAuth := auth.PublicKeyID != "" || auth.PrivateKey != "" || auth.Passphrase != ""
+	if jwtAuth && auth.PublicKeyID == "" {
+		missing = append(missing, "boxAppSettings.appAuth.publicKeyID")
+	}
+	if jwtAuth && auth.PrivateKey == "" {
+		missing = append(missing, "boxAppSettings.appAuth.privateKey")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("box: config is missing %s", strings.Join(missing, ", "))
+	}
+
+	if _, _, err := cfg.subject(); err != nil {
+		return err
+	}
+	if jwtAuth {
+		if _, err := cfg.privateKey(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// privateKey decodes the config's private key, decrypting it with the
+// passphrase if it is encrypted.
+func (cfg *Config) privateKey() (*rsa.PrivateKey, error) {
+	auth := cfg.BoxAppSettings.AppAuth
+	if auth.PrivateKey == "" {
+		return nil, errors.New("box: config has no private key for JWT authentication")
+	}
+
+	block, _ := pem.Decode([]byte(auth.PrivateKey))
+	if block == nil {
+		return nil, errors.New("box: private key is not PEM encoded")
+	}
+	encrypted := block.Type == "ENCRYPTED PRIVATE KEY" ||
+		strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED")
+	if encrypted && auth.Passphrase == "" {
+		return nil, errors.New("box: private key is encrypted but the config has no passphrase")
+	}
+
+	var key *rsa.PrivateKey
+	var err error
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		key, err = decryptPKCS8(block.Bytes, []byte(auth.Passphrase))
+	case encrypted:
+		key, err = jwt.ParseRSAPrivateKeyFromPEMWithPassword([]byte(auth.PrivateKey), auth.Passphrase)
+	default:
+		key, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(auth.PrivateKey))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("box: decrypting private key: %w", err)
+	}
+	return key, nil
+}
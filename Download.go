@@ -0,0 +1,334 @@
+package box
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// ErrChecksum is returned, wrapped, when downloaded content does not match
+// the SHA1 Box reported for the file.
+var ErrChecksum = errors.New("box: downloaded content does not match its SHA1")
+
+// DownloadOptions select what part of a file is downloaded.
+type DownloadOptions struct {
+	// Version is the ID of the file version to download. The current version
+	// is downloaded by default.
+	Version string
+
+	// Offset and Length select a byte range of the file. A zero Length reads
+	// to the end of the file.
+	Offset int64
+	Length int64
+
+	// SHA1 is the expected SHA1 of the file, as reported in FileObject.Sha1.
+	// When the whole file is downloaded its content is verified once
+	// complete, against SHA1 or, if it is empty, against the SHA1 Box
+	// reports for the file or version, which takes an extra request.
+	SHA1 string
+}
+
+// rangeHeader returns the Range header for the options, or "" for the whole
+// file.
+func (opts *DownloadOptions) rangeHeader() string {
+	if opts.Offset == 0 && opts.Length == 0 {
+		return ""
+	}
+	if opts.Length == 0 {
+		return "bytes=" + strconv.FormatInt(opts.Offset, 10) + "-"
+	}
+	return "bytes=" + strconv.FormatInt(opts.Offset, 10) + "-" + strconv.FormatInt(opts.Offset+opts.Length-1, 10)
+}
+
+// contentURL is the URL a file's content is downloaded from.
+func (sdk *SDK) contentURL(fileID, version string) string {
+	u := sdk.fileURL() + fileID + "/content"
+	if version != "" {
+		u += "?version=" + url.QueryEscape(version)
+	}
+	return u
+}
+
+// DownloadStream opens the content of a file for reading. The caller must
+// close the returned reader. If the whole file is requested, reading the
+// final byte fails with ErrChecksum when the content does not match its
+// SHA1, as described for DownloadOptions.SHA1.
+func (sdk *SDK) DownloadStream(fileID string, opts *DownloadOptions) (io.ReadCloser, error) {
+	return sdk.DownloadStreamContext(context.Background(), fileID, opts)
+}
+
+// DownloadStreamContext is like DownloadStream but uses ctx for its requests.
+// The context also applies while the content is read.
+func (sdk *SDK) DownloadStreamContext(ctx context.Context, fileID string, opts *DownloadOptions) (io.ReadCloser, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	sum := opts.SHA1
+	if sum == "" && opts.rangeHeader() == "" {
+		var err error
+		if sum, err = sdk.contentSHA1(ctx, fileID, opts.Version); err != nil {
+			return nil, err
+		}
+	}
+
+	headers := make(map[string]string)
+	if r := opts.rangeHeader(); r != "" {
+		headers["Range"] = r
+	}
+	response, err := sdk.do(ctx, "GET", sdk.contentURL(fileID, opts.Version), nil, headers, true)
+	if err != nil {
+		return nil, err
+	}
+
+	body := response.Body
+	if response.StatusCode != http.StatusPartialContent && opts.rangeHeader() != "" {
+		// The whole file was sent; cut out the requested range.
+		if _, err := io.CopyN(ioutil.Discard, body, opts.Offset); err != nil && err != io.EOF {
+			body.Close()
+			return nil, fmt.Errorf("box: reading download: %w", err)
+		}
+		if opts.Length > 0 {
+			body = struct {
+				io.Reader
+				io.Closer
+			}{io.LimitReader(body, opts.Length), body}
+		}
+	}
+	if sum != "" && opts.rangeHeader() == "" {
+		body = &verifyingReader{ReadCloser: body, hash: sha1.New(), sha1: sum}
+	}
+	return body, nil
+}
+
+// contentSHA1 returns the SHA1 Box reports for a file, or for one of its
+// versions if version is set.
+func (sdk *SDK) contentSHA1(ctx context.Context, fileID, version string) (string, error) {
+	if version != "" {
+		fileVersion, err := sdk.GetFileVersionContext(ctx, fileID, version)
+		if err != nil {
+			return "", err
+		}
+		return fileVersion.Sha1, nil
+	}
+	fInfo, err := sdk.GetFileInfoContext(ctx, fileID)
+	if err != nil {
+		return "", err
+	}
+	return fInfo.Sha1, nil
+}
+
+// DownloadTo writes the content of a file to w and returns the number of
+// bytes written. The content is streamed rather than held in memory, and a
+// whole file is verified as DownloadStream does.
+func (sdk *SDK) DownloadTo(fileID string, w io.Writer, opts *DownloadOptions) (int64, error) {
+	return sdk.DownloadToContext(context.Background(), fileID, w, opts)
+}
+
+// DownloadToContext is like DownloadTo but uses ctx for its requests.
+func (sdk *SDK) DownloadToContext(ctx context.Context, fileID string, w io.Writer, opts *DownloadOptions) (int64, error) {
+	body, err := sdk.DownloadStreamContext(ctx, fileID, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.Copy(w, body)
+	if err != nil {
+		if errors.Is(err, ErrChecksum) {
+			return n, err
+		}
+		return n, fmt.Errorf("box: downloading file %s: %w", fileID, err)
+	}
+	return n, nil
+}
+
+// verifyingReader checks the SHA1 of the content read through it once the
+// end is reached.
+type verifyingReader struct {
+	io.ReadCloser
+	hash hash.Hash
+	sha1 string
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if sum := hex.EncodeToString(r.hash.Sum(nil)); sum != r.sha1 {
+			return n, fmt.Errorf("%w: got %s, want %s", ErrChecksum, sum, r.sha1)
+		}
+	}
+	return n, err
+}
+
+// DownloadToFile downloads the content of a file to name. The content is
+// written to name+".part" first, and an interrupted download resumes from
+// the bytes already there unless the file has changed on Box since. Within a
+// call, dropped connections are resumed according to the SDK's RetryPolicy.
+// The completed file is verified against the file's SHA1.
+func (sdk *SDK) DownloadToFile(fileID, name string) error {
+	return sdk.DownloadToFileContext(context.Background(), fileID, name)
+}
+
+// DownloadToFileContext is like DownloadToFile but uses ctx for its requests.
+func (sdk *SDK) DownloadToFileContext(ctx context.Context, fileID, name string) error {
+	fInfo, err := sdk.GetFileInfoContext(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	return sdk.downloadToFile(ctx, fInfo, name)
+}
+
+// partState records which content a partial download holds, so that it is
+// only resumed for the same version of the file.
+type partState struct {
+	ETag string `json:"etag,omitempty"`
+	SHA1 string `json:"sha1"`
+}
+
+// downloadToFile downloads the file described by fInfo to name, resuming
+// from name+".part".
+func (sdk *SDK) downloadToFile(ctx context.Context, fInfo *FileObject, name string) error {
+	part := name + ".part"
+	statePath := part + ".json"
+
+	file, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("box: creating download file: %w", err)
+	}
+	defer file.Close()
+
+	var state partState
+	if content, err := ioutil.ReadFile(statePath); err == nil {
+		json.Unmarshal(content, &state)
+	}
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("box: reading download file: %w", err)
+	}
+	if state.SHA1 != fInfo.Sha1 || offset > int64(fInfo.Size) {
+		// The partial content is of another version; start over.
+		state = partState{SHA1: fInfo.Sha1}
+		if offset, err = restart(file); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 1; offset == 0 || offset < int64(fInfo.Size); attempt++ {
+		headers := make(map[string]string)
+		if offset > 0 {
+			headers["Range"] = "bytes=" + strconv.FormatInt(offset, 10) + "-"
+			if state.ETag != "" {
+				headers["If-Range"] = state.ETag
+			}
+		}
+		response, err := sdk.do(ctx, "GET", sdk.contentURL(fInfo.ID, ""), nil, headers, true)
+		if err != nil {
+			return err
+		}
+
+		if response.StatusCode != http.StatusPartialContent && offset > 0 {
+			// The content changed since the partial download began.
+			if offset, err = restart(file); err != nil {
+				response.Body.Close()
+				return err
+			}
+		}
+		state.ETag = response.Header.Get("ETag")
+		if err := writePartState(statePath, state); err != nil {
+			response.Body.Close()
+			return err
+		}
+
+		w := &trackingWriter{w: file}
+		_, err = io.Copy(w, response.Body)
+		response.Body.Close()
+		offset += w.n
+		if w.err != nil {
+			return fmt.Errorf("box: writing download file: %w", w.err)
+		}
+		if err == nil {
+			break
+		}
+
+		err = fmt.Errorf("box: downloading file %s: %w", fInfo.ID, err)
+		delay, retry := sdk.retry.retryDelay("GET", attempt, err)
+		if !retry {
+			return err
+		}
+		sdk.logf("box: resuming download of file %s at byte %d in %s: %v", fInfo.ID, offset, delay, err)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("box: reading download file: %w", err)
+	}
+	_, err = io.Copy(ioutil.Discard, &verifyingReader{ReadCloser: file, hash: sha1.New(), sha1: fInfo.Sha1})
+	if err != nil {
+		file.Close()
+		if errors.Is(err, ErrChecksum) {
+			os.Remove(part)
+			os.Remove(statePath)
+			return err
+		}
+		return fmt.Errorf("box: reading download file: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("box: writing download file: %w", err)
+	}
+	if err := os.Rename(part, name); err != nil {
+		return fmt.Errorf("box: saving download file: %w", err)
+	}
+	os.Remove(statePath)
+	return nil
+}
+
+// restart empties a partial download.
+func restart(file *os.File) (int64, error) {
+	if err := file.Truncate(0); err != nil {
+		return 0, fmt.Errorf("box: truncating download file: %w", err)
+	}
+	return file.Seek(0, io.SeekStart)
+}
+
+// writePartState saves the state of a partial download.
+func writePartState(path string, state partState) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("box: encoding download state: %w", err)
+	}
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("box: saving download state: %w", err)
+	}
+	return nil
+}
+
+// trackingWriter counts the bytes written to w and keeps the first error, so
+// that failed writes can be told apart from failed reads.
+type trackingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.n += int64(n)
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	return n, err
+}
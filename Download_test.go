@@ -0,0 +1,215 @@
+package box
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghostofcookie/gobox/boxtest"
+)
+
+var downloadContent = []byte("The quick brown fox jumps over the lazy dog")
+
+func downloadSHA1() string {
+	sum := sha1.Sum(downloadContent)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDownloadTo(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	fileID := srv.AddFile(boxtest.RootID, "fox.txt", downloadContent)
+
+	t.Run("TestWholeFile", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := sdk.DownloadTo(fileID, &buf, &DownloadOptions{SHA1: downloadSHA1()})
+		if err != nil {
+			t.Fatal("Expected the download to succeed, got", err)
+		}
+		if n != int64(len(downloadContent)) || !bytes.Equal(buf.Bytes(), downloadContent) {
+			t.Error("Expected the file content, got", buf.String())
+		}
+	})
+
+	t.Run("TestRange", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := sdk.DownloadTo(fileID, &buf, &DownloadOptions{Offset: 4, Length: 5})
+		if err != nil {
+			t.Fatal("Expected the download to succeed, got", err)
+		}
+		if buf.String() != "quick" {
+			t.Error("Expected the requested range, got", buf.String())
+		}
+
+		buf.Reset()
+		_, err = sdk.DownloadTo(fileID, &buf, &DownloadOptions{Offset: 40})
+		if err != nil || buf.String() != "dog" {
+			t.Error("Expected the rest of the file, got", buf.String(), err)
+		}
+	})
+
+	t.Run("TestChecksumMismatch", func(t *testing.T) {
+		_, err := sdk.DownloadTo(fileID, ioutil.Discard, &DownloadOptions{SHA1: "0000"})
+		if !errors.Is(err, ErrChecksum) {
+			t.Error("Expected a checksum error, got", err)
+		}
+	})
+
+	t.Run("TestDefaultChecksum", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := sdk.DownloadTo(fileID, &buf, nil); err != nil || !bytes.Equal(buf.Bytes(), downloadContent) {
+			t.Fatal("Expected the verified file content, got", buf.String(), err)
+		}
+
+		srv.CorruptNextDownload()
+		if _, err := sdk.DownloadTo(fileID, ioutil.Discard, nil); !errors.Is(err, ErrChecksum) {
+			t.Error("Expected the content to be checked against the file's SHA1, got", err)
+		}
+	})
+
+	t.Run("TestNotFound", func(t *testing.T) {
+		_, err := sdk.DownloadTo("404", ioutil.Discard, nil)
+		if !IsNotFound(err) {
+			t.Error("Expected a not found error, got", err)
+		}
+	})
+}
+
+func TestDownloadStream(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	fileID := srv.AddFile(boxtest.RootID, "fox.txt", downloadContent)
+
+	body, err := sdk.DownloadStream(fileID, &DownloadOptions{SHA1: downloadSHA1()})
+	if err != nil {
+		t.Fatal("Expected the download to open, got", err)
+	}
+	defer body.Close()
+	got, err := ioutil.ReadAll(body)
+	if err != nil || !bytes.Equal(got, downloadContent) {
+		t.Error("Expected the file content, got", string(got), err)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	fileID := srv.AddFile(boxtest.RootID, "fox.txt", downloadContent)
+
+	dir, err := ioutil.TempDir("", "box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := sdk.DownloadFile(fileID, dir); err != nil {
+		t.Fatal("Expected the download to succeed, got", err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dir, "fox.txt"))
+	if err != nil || !bytes.Equal(got, downloadContent) {
+		t.Error("Expected the file to be saved under its name, got", string(got), err)
+	}
+}
+
+func TestDownloadToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("TestResume", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		fileID := srv.AddFile(boxtest.RootID, "fox.txt", downloadContent)
+		name := filepath.Join(dir, "resume.txt")
+
+		srv.CutNextDownload(10)
+		if err := sdk.DownloadToFile(fileID, name); err == nil {
+			t.Fatal("Expected the interrupted download to fail")
+		}
+		if part, _ := ioutil.ReadFile(name + ".part"); len(part) != 10 {
+			t.Fatal("Expected the partial content to be kept, got", len(part))
+		}
+
+		if err := sdk.DownloadToFile(fileID, name); err != nil {
+			t.Fatal("Expected the download to resume, got", err)
+		}
+		header := srv.LastHeader()
+		if header.Get("Range") != "bytes=10-" || header.Get("If-Range") == "" {
+			t.Error("Expected a conditional range request, got", header)
+		}
+		got, err := ioutil.ReadFile(name)
+		if err != nil || !bytes.Equal(got, downloadContent) {
+			t.Error("Expected the complete file, got", string(got), err)
+		}
+		if _, err := os.Stat(name + ".part"); !os.IsNotExist(err) {
+			t.Error("Expected the partial file to be removed")
+		}
+	})
+
+	t.Run("TestResumeWithinCall", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+		fileID := srv.AddFile(boxtest.RootID, "fox.txt", downloadContent)
+		name := filepath.Join(dir, "flaky.txt")
+
+		srv.CutNextDownload(10)
+		if err := sdk.DownloadToFile(fileID, name); err != nil {
+			t.Fatal("Expected the download to resume, got", err)
+		}
+		got, err := ioutil.ReadFile(name)
+		if err != nil || !bytes.Equal(got, downloadContent) {
+			t.Error("Expected the complete file, got", string(got), err)
+		}
+	})
+
+	t.Run("TestChangedFile", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		fileID := srv.AddFile(boxtest.RootID, "fox.txt", downloadContent)
+		name := filepath.Join(dir, "changed.txt")
+
+		srv.CutNextDownload(10)
+		sdk.DownloadToFile(fileID, name)
+		changed := []byte("A completely different file")
+		srv.SetContent(fileID, changed)
+
+		if err := sdk.DownloadToFile(fileID, name); err != nil {
+			t.Fatal("Expected the download to restart, got", err)
+		}
+		if srv.LastHeader().Get("Range") != "" {
+			t.Error("Expected the download to start from scratch")
+		}
+		got, err := ioutil.ReadFile(name)
+		if err != nil || !bytes.Equal(got, changed) {
+			t.Error("Expected the new content, got", string(got), err)
+		}
+	})
+
+	t.Run("TestStaleETag", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		fileID := srv.AddFile(boxtest.RootID, "fox.txt", downloadContent)
+		name := filepath.Join(dir, "stale.txt")
+
+		// A partial download whose ETag no longer matches the content.
+		ioutil.WriteFile(name+".part", []byte("The slow"), 0644)
+		writePartState(name+".part.json", partState{ETag: `"stale"`, SHA1: downloadSHA1()})
+
+		if err := sdk.DownloadToFile(fileID, name); err != nil {
+			t.Fatal("Expected the download to restart, got", err)
+		}
+		got, err := ioutil.ReadFile(name)
+		if err != nil || !bytes.Equal(got, downloadContent) {
+			t.Error("Expected the complete file, got", string(got), err)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package box
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIError is an error response returned by the Box API. Use errors.As to
+// retrieve it from an error returned by the SDK.
+type APIError struct {
+	StatusCode int    // HTTP status code of the response.
+	Type       string // Usually "error".
+	Code       string // Box error code, e.g. "item_name_in_use".
+	Message    string
+	HelpURL    string
+	RequestID  string
+
+	// RetryAfter is the delay requested by the Retry-After header, if any.
+	RetryAfter time.Duration
+
+	// Conflicts holds the existing items that caused a name conflict.
+	Conflicts []*Item
+}
+
+// apiErrorBody is the wire format of Box API and OAuth 2.0 error responses.
+type apiErrorBody struct {
+	Type        string `json:"type"`
+	Status      int    `json:"status"`
+	Code        string `json:"code"`
+	ContextInfo struct {
+		Conflicts json.RawMessage `json:"conflicts"`
+	} `json:"context_info"`
+	HelpURL          string `json:"help_url"`
+	Message          string `json:"message"`
+	RequestID        string `json:"request_id"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// newAPIError builds an APIError from a not OK http response and its body.
+func newAPIError(response *http.Response, body []byte) *APIError {
+	var raw apiErrorBody
+	json.Unmarshal(body, &raw)
+
+	apiErr := &APIError{
+		StatusCode: response.StatusCode,
+		Type:       raw.Type,
+		Code:       raw.Code,
+		Message:    raw.Message,
+		HelpURL:    raw.HelpURL,
+		RequestID:  raw.RequestID,
+		RetryAfter: retryAfter(response.Header.Get("Retry-After")),
+	}
+	// OAuth 2.0 endpoints report errors in the RFC 6749 format instead.
+	if apiErr.Code == "" {
+		apiErr.Code = raw.Error
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = raw.ErrorDescription
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(response.StatusCode)
+	}
+
+	// Conflicts are a single item for uploads and a list for folders.
+	if len(raw.ContextInfo.Conflicts) > 0 {
+		var item *Item
+		if json.Unmarshal(raw.ContextInfo.Conflicts, &apiErr.Conflicts) != nil &&
+			json.Unmarshal(raw.ContextInfo.Conflicts, &item) == nil && item != nil {
+			apiErr.Conflicts = []*Item{item}
+		}
+	}
+	return apiErr
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func (e *APIError) Error() string {
+	msg := "box: " + strconv.Itoa(e.StatusCode)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	msg += " \"" + e.Message + "\""
+	if e.RequestID != "" {
+		msg += " request_id=" + e.RequestID
+	}
+	return msg
+}
+
+// ConflictingItem returns the existing item that caused a name conflict, or
+// nil if the error is not a conflict.
+func (e *APIError) ConflictingItem() *Item {
+	if len(e.Conflicts) == 0 {
+		return nil
+	}
+	return e.Conflicts[0]
+}
+
+// hasStatus reports whether err is an APIError with the given status code.
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// IsNotFound reports whether err is a Box 404 Not Found response.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is a Box 409 Conflict response, such as an
+// item name already being in use.
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsPreconditionFailed reports whether err is a Box 412 Precondition Failed
+// response, such as an If-Match etag no longer matching the item.
+func IsPreconditionFailed(err error) bool {
+	return hasStatus(err, http.StatusPreconditionFailed)
+}
+
+// IsRateLimited reports whether err is a Box 429 Too Many Requests response.
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// ConflictingItem returns the existing item reported by a conflict error, or
+// nil if err does not carry one.
+func ConflictingItem(err error) *Item {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+	return apiErr.ConflictingItem()
+}
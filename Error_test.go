@@ -0,0 +1,70 @@
+package box
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ghostofcookie/gobox/boxtest"
+)
+
+func TestAPIError(t *testing.T) {
+	t.Run("TestNotFound", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.RequestAccessToken()
+		_, err := sdk.GetFileInfo("404")
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatal("Expected an *APIError, got", err)
+		}
+		if !IsNotFound(err) || IsConflict(err) || IsRateLimited(err) {
+			t.Error("Expected only IsNotFound to match")
+		}
+		if apiErr.Code != "not_found" || apiErr.RequestID == "" || apiErr.HelpURL == "" {
+			t.Errorf("Expected the response details to be kept, got %+v", apiErr)
+		}
+	})
+
+	t.Run("TestUploadConflict", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.RequestAccessToken()
+		id := srv.AddFile(boxtest.RootID, "a.txt", []byte("a"))
+
+		_, err := sdk.UploadFile([]byte("b"), "a.txt", "0")
+		if !IsConflict(err) {
+			t.Fatal("Expected a conflict, got", err)
+		}
+		if item := ConflictingItem(err); item == nil || item.ID != id || item.Type != "file" {
+			t.Errorf("Expected the existing file %s, got %+v", id, item)
+		}
+	})
+
+	t.Run("TestFolderConflict", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.RequestAccessToken()
+		id := srv.AddFolder(boxtest.RootID, "docs")
+
+		_, err := sdk.CreateFolder("docs", "0")
+		if !IsConflict(err) {
+			t.Fatal("Expected a conflict, got", err)
+		}
+		if item := ConflictingItem(err); item == nil || item.ID != id || item.Type != "folder" {
+			t.Errorf("Expected the existing folder %s, got %+v", id, item)
+		}
+	})
+
+	t.Run("TestOAuthError", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		srv.ClientSecret = "other"
+
+		err := sdk.RequestAccessToken()
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != "invalid_client" || apiErr.Message == "" {
+			t.Errorf("Expected an invalid_client error, got %v", err)
+		}
+	})
+}
@@ -2,61 +2,70 @@ package box
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
-	"io/ioutil"
-	"log"
+	"io"
 	"mime/multipart"
+	"net/http"
 	"os"
-	"reflect"
+	"path/filepath"
 	"strconv"
-	"strings"
-)
-
-const (
-	fileURL   = "https://api.box.com/2.0/files/"
-	uploadURL = "https://upload.box.com/api/2.0/files/content"
+	"time"
 )
 
 // GetFileInfo : Get information about a file.
 func (sdk *SDK) GetFileInfo(fileID string) (*FileObject, error) {
-	response, err := sdk.request("GET", fileURL+fileID, nil, nil)
+	return sdk.GetFileInfoContext(context.Background(), fileID)
+}
+
+// GetFileInfoContext is like GetFileInfo but uses ctx for its requests.
+func (sdk *SDK) GetFileInfoContext(ctx context.Context, fileID string) (*FileObject, error) {
+	response, err := sdk.request(ctx, "GET", sdk.fileURL()+fileID, nil, nil)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 	fileObject := &FileObject{}
-	json.Unmarshal(response, &fileObject)
-
+	if err := unmarshal(response, fileObject); err != nil {
+		return nil, err
+	}
 	return fileObject, nil
 }
 
 // GetThumbnail gets a thumbnail image for the requested file.
 func (sdk *SDK) GetThumbnail(fileID, extension string, minHeight, minWidth int) (image.Image, error) {
+	return sdk.GetThumbnailContext(context.Background(), fileID, extension, minHeight, minWidth)
+}
+
+// GetThumbnailContext is like GetThumbnail but uses ctx for its requests.
+func (sdk *SDK) GetThumbnailContext(ctx context.Context, fileID, extension string, minHeight, minWidth int) (image.Image, error) {
 	opts := "?min_height=" + strconv.Itoa(minHeight) + "&min_width=" + strconv.Itoa(minWidth)
-	response, err := sdk.request("GET", fileURL+fileID+"/thumbnail."+extension+opts, nil, nil)
+	response, err := sdk.request(ctx, "GET", sdk.fileURL()+fileID+"/thumbnail."+extension+opts, nil, nil)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	var image []byte
-	json.Unmarshal(response, &image)
-
 	switch extension {
 	case "png":
-		return png.Decode(bytes.NewReader(image))
-	case "jpg":
-	case "jpeg":
-		return jpeg.Decode(bytes.NewReader(image))
+		return png.Decode(bytes.NewReader(response))
+	case "jpg", "jpeg":
+		return jpeg.Decode(bytes.NewReader(response))
 	}
-	return nil, nil
+	return nil, fmt.Errorf("box: unsupported thumbnail extension %q", extension)
 }
 
 // CopyFile copies a file. The version and a new name can be optionally supplied.
 func (sdk *SDK) CopyFile(fileID, folderID, name, version string) (*FileObject, error) {
+	return sdk.CopyFileContext(context.Background(), fileID, folderID, name, version)
+}
+
+// CopyFileContext is like CopyFile but uses ctx for its requests.
+func (sdk *SDK) CopyFileContext(ctx context.Context, fileID, folderID, name, version string) (*FileObject, error) {
 	body := map[string]interface{}{"parent": map[string]string{"id": folderID}}
 	if name != "" {
 		body["name"] = name
@@ -65,197 +74,775 @@ func (sdk *SDK) CopyFile(fileID, folderID, name, version string) (*FileObject, e
 		body["version"] = version
 	}
 	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("box: encoding copy request: %w", err)
+	}
 
 	headers := map[string]string{"Content-Type": "application/json"}
-	response, err := sdk.request("POST", fileURL+fileID+"/copy", bytes.NewBufferString(string(payload)), headers)
+	response, err := sdk.request(ctx, "POST", sdk.fileURL()+fileID+"/copy", bytes.NewBufferString(string(payload)), headers)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 	fileObject := &FileObject{}
-	json.Unmarshal(response, &fileObject)
-
+	if err := unmarshal(response, fileObject); err != nil {
+		return nil, err
+	}
 	return fileObject, nil
 }
 
 // GetEmbedLink returns information about the file with 'ID' fileID.
 func (sdk *SDK) GetEmbedLink(fileID string) (*EmbeddedFile, error) {
-	sdk.RequestAccessToken()
-	response, err := sdk.request("GET", fileURL+fileID+"?fields=expiring_embed_link", nil, nil)
+	return sdk.GetEmbedLinkContext(context.Background(), fileID)
+}
+
+// GetEmbedLinkContext is like GetEmbedLink but uses ctx for its requests.
+func (sdk *SDK) GetEmbedLinkContext(ctx context.Context, fileID string) (*EmbeddedFile, error) {
+	response, err := sdk.request(ctx, "GET", sdk.fileURL()+fileID+"?fields=expiring_embed_link", nil, nil)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 	fileObject := &EmbeddedFile{}
-	json.Unmarshal(response, &fileObject)
-
+	if err := unmarshal(response, fileObject); err != nil {
+		return nil, err
+	}
 	return fileObject, nil
 }
 
-// UpdateFile updates the file with a new name and content.
-func (sdk *SDK) UpdateFile(fileID, newFilename string) error {
-	return errors.New("No implementation for (SDK)UpdateFile()")
+// SharedLinkUpdate : The settings of a shared link to create or change.
+type SharedLinkUpdate struct {
+	Access     string     `json:"access,omitempty"` // open, company or collaborators
+	Password   *string    `json:"password,omitempty"`
+	VanityName string     `json:"vanity_name,omitempty"`
+	UnsharedAt *time.Time `json:"unshared_at,omitempty"`
+
+	Permissions *SharedLinkPermissions `json:"permissions,omitempty"`
+}
+
+// SharedLinkPermissions : What users of a shared link may do. Nil fields are
+// left unchanged.
+type SharedLinkPermissions struct {
+	CanDownload *bool `json:"can_download,omitempty"`
+	CanPreview  *bool `json:"can_preview,omitempty"`
+	CanEdit     *bool `json:"can_edit,omitempty"`
+}
+
+// LockUpdate : The settings of a lock to place on a file.
+type LockUpdate struct {
+	// ExpiresAt is when the lock is released. The zero value locks the file
+	// until it is unlocked.
+	ExpiresAt           time.Time
+	IsDownloadPrevented bool
+}
+
+// FileUpdate : The changes to make to a file. Zero fields are left unchanged.
+type FileUpdate struct {
+	Name string
+
+	// ParentID moves the file to another folder.
+	ParentID string
+
+	// Description and Tags replace the current values when not nil. An empty
+	// value clears them.
+	Description *string
+	Tags        []string
+
+	// SharedLink creates or changes the file's shared link, and
+	// RemoveSharedLink removes it.
+	SharedLink       *SharedLinkUpdate
+	RemoveSharedLink bool
+
+	// Lock locks the file and Unlock removes its lock.
+	Lock   *LockUpdate
+	Unlock bool
+
+	// DispositionAt is when the file is disposed of under its retention
+	// policy.
+	DispositionAt time.Time
+
+	// CollectionIDs replaces the collections the file is in when not nil,
+	// e.g. []string{"12345"} for a user's favorites.
+	CollectionIDs []string
+}
+
+// body returns the request body for the update.
+func (u *FileUpdate) body() map[string]interface{} {
+	body := make(map[string]interface{})
+	if u.Name != "" {
+		body["name"] = u.Name
+	}
+	if u.ParentID != "" {
+		body["parent"] = map[string]string{"id": u.ParentID}
+	}
+	if u.Description != nil {
+		body["description"] = *u.Description
+	}
+	if u.Tags != nil {
+		body["tags"] = u.Tags
+	}
+	if u.SharedLink != nil {
+		body["shared_link"] = u.SharedLink
+	} else if u.RemoveSharedLink {
+		body["shared_link"] = nil
+	}
+	if u.Lock != nil {
+		lock := map[string]interface{}{
+			"access":                "lock",
+			"is_download_prevented": u.Lock.IsDownloadPrevented,
+		}
+		if !u.Lock.ExpiresAt.IsZero() {
+			lock["expires_at"] = u.Lock.ExpiresAt.Format(time.RFC3339)
+		}
+		body["lock"] = lock
+	} else if u.Unlock {
+		body["lock"] = nil
+	}
+	if !u.DispositionAt.IsZero() {
+		body["disposition_at"] = u.DispositionAt.Format(time.RFC3339)
+	}
+	if u.CollectionIDs != nil {
+		collections := make([]map[string]string, len(u.CollectionIDs))
+		for i, id := range u.CollectionIDs {
+			collections[i] = map[string]string{"id": id}
+		}
+		body["collections"] = collections
+	}
+	return body
+}
+
+// UpdateFile renames, moves or otherwise changes a file. If etag is set the
+// update fails with a 412 Precondition Failed error when the file has
+// changed since. A nil update leaves the file unchanged.
+func (sdk *SDK) UpdateFile(fileID string, update *FileUpdate, etag string) (*FileObject, error) {
+	return sdk.UpdateFileContext(context.Background(), fileID, update, etag)
+}
+
+// UpdateFileContext is like UpdateFile but uses ctx for its requests.
+func (sdk *SDK) UpdateFileContext(ctx context.Context, fileID string, update *FileUpdate, etag string) (*FileObject, error) {
+	if update == nil {
+		update = &FileUpdate{}
+	}
+	payload, err := json.Marshal(update.body())
+	if err != nil {
+		return nil, fmt.Errorf("box: encoding file update: %w", err)
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	if etag != "" {
+		headers["If-Match"] = etag
+	}
+	response, err := sdk.request(ctx, "PUT", sdk.fileURL()+fileID, bytes.NewReader(payload), headers)
+	if err != nil {
+		return nil, err
+	}
+	fileObject := &FileObject{}
+	if err := unmarshal(response, fileObject); err != nil {
+		return nil, err
+	}
+	return fileObject, nil
 }
 
 // DeleteFile deletes a file in a specific folder with an 'ID' matching fileID.
 func (sdk *SDK) DeleteFile(fileID, etag string) error {
+	return sdk.DeleteFileContext(context.Background(), fileID, etag)
+}
+
+// DeleteFileContext is like DeleteFile but uses ctx for its requests.
+func (sdk *SDK) DeleteFileContext(ctx context.Context, fileID, etag string) error {
 	headers := make(map[string]string)
 	headers["If-Match"] = etag
-	_, err := sdk.request("DELETE", fileURL+fileID, nil, headers)
+	_, err := sdk.request(ctx, "DELETE", sdk.fileURL()+fileID, nil, headers)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 	return nil
 }
 
-// DownloadFile : Retrieves the actual data of the file. An optional version
-// parameter can be set to download a previous version of the file.
+// DownloadFile : Retrieves the actual data of the file and saves it under
+// its name in the directory location. Interrupted downloads resume as with
+// DownloadToFile, and the content is verified against the file's SHA1.
 func (sdk *SDK) DownloadFile(fileID, location string) error {
-	response, err := sdk.request("GET", fileURL+fileID+"/content", nil, nil)
+	return sdk.DownloadFileContext(context.Background(), fileID, location)
+}
+
+// DownloadFileContext is like DownloadFile but uses ctx for its requests.
+func (sdk *SDK) DownloadFileContext(ctx context.Context, fileID, location string) error {
+	fInfo, err := sdk.GetFileInfoContext(ctx, fileID)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
+	return sdk.downloadToFile(ctx, fInfo, filepath.Join(location, filepath.Base(fInfo.Name)))
+}
+
+// UploadOptions are optional settings for an upload.
+type UploadOptions struct {
+	// ContentCreatedAt and ContentModifiedAt are the times the content was
+	// created and last modified outside of Box.
+	ContentCreatedAt  time.Time
+	ContentModifiedAt time.Time
+
+	// SHA1 is the hex-encoded SHA1 of the content. It is sent in the
+	// Content-MD5 header, which Box uses to reject corrupted uploads. Uploads
+	// from files compute it when it is not set.
+	SHA1 string
+}
+
+// uploadAttributes is the attributes part of an upload.
+type uploadAttributes struct {
+	Name   string `json:"name,omitempty"`
+	Parent *struct {
+		ID string `json:"id"`
+	} `json:"parent,omitempty"`
+	ContentCreatedAt  string `json:"content_created_at,omitempty"`
+	ContentModifiedAt string `json:"content_modified_at,omitempty"`
+}
 
-	if location == "." || location == ".." || !strings.HasSuffix(location, "/") {
-		location += "/"
+// newUploadAttributes returns the attributes of an upload called name to the
+// folder with ID folderID. Either may be empty for new versions.
+func newUploadAttributes(name, folderID string, opts *UploadOptions) *uploadAttributes {
+	attrs := &uploadAttributes{Name: name}
+	if folderID != "" {
+		attrs.Parent = &struct {
+			ID string `json:"id"`
+		}{folderID}
 	}
+	if !opts.ContentCreatedAt.IsZero() {
+		attrs.ContentCreatedAt = opts.ContentCreatedAt.Format(time.RFC3339)
+	}
+	if !opts.ContentModifiedAt.IsZero() {
+		attrs.ContentModifiedAt = opts.ContentModifiedAt.Format(time.RFC3339)
+	}
+	return attrs
+}
+
+// UploadFromReader uploads the content read from r as a new file called
+// fileName in the folder with ID folderID. The content is streamed rather
+// than held in memory, so a failed upload is only retried if r is an
+// io.Seeker. Content of a reader that can't seek is of unknown size and is
+// sent chunked, which some proxies reject.
+func (sdk *SDK) UploadFromReader(r io.Reader, fileName, folderID string, opts *UploadOptions) (*FileObject, error) {
+	return sdk.UploadFromReaderContext(context.Background(), r, fileName, folderID, opts)
+}
+
+// UploadFromReaderContext is like UploadFromReader but uses ctx for its
+// requests.
+func (sdk *SDK) UploadFromReaderContext(ctx context.Context, r io.Reader, fileName, folderID string, opts *UploadOptions) (*FileObject, error) {
+	return sdk.uploadFileObject(ctx, sdk.uploadURL(), r, -1, fileName, folderID, opts, nil)
+}
 
-	fInfo, err := sdk.GetFileInfo(fileID)
-	file, err := os.Create(location + fInfo.Name)
+// UploadFromFile uploads the content of f, from its start, as a new file
+// called fileName in the folder with ID folderID. If fileName is empty the
+// file keeps its local name.
+func (sdk *SDK) UploadFromFile(f *os.File, fileName, folderID string, opts *UploadOptions) (*FileObject, error) {
+	return sdk.UploadFromFileContext(context.Background(), f, fileName, folderID, opts)
+}
+
+// UploadFromFileContext is like UploadFromFile but uses ctx for its requests.
+func (sdk *SDK) UploadFromFileContext(ctx context.Context, f *os.File, fileName, folderID string, opts *UploadOptions) (*FileObject, error) {
+	if fileName == "" {
+		fileName = filepath.Base(f.Name())
+	}
+	size, opts, err := prepareFile(f, opts)
 	if err != nil {
-		log.Fatalln(err)
-		return err
+		return nil, err
 	}
-	defer file.Close()
+	return sdk.uploadFileObject(ctx, sdk.uploadURL(), f, size, fileName, folderID, opts, nil)
+}
 
-	_, err = file.Write(response)
+// UploadFromPath uploads the file at path as UploadFromFile does.
+func (sdk *SDK) UploadFromPath(path, fileName, folderID string, opts *UploadOptions) (*FileObject, error) {
+	return sdk.UploadFromPathContext(context.Background(), path, fileName, folderID, opts)
+}
+
+// UploadFromPathContext is like UploadFromPath but uses ctx for its requests.
+func (sdk *SDK) UploadFromPathContext(ctx context.Context, path, fileName, folderID string, opts *UploadOptions) (*FileObject, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		log.Fatalln(err)
-		return err
+		return nil, fmt.Errorf("box: opening upload: %w", err)
 	}
-	return nil
+	defer file.Close()
+	return sdk.UploadFromFileContext(ctx, file, fileName, folderID, opts)
 }
 
-// UploadFile uses the Upload API to allow users to add a new file. The user
-// can then upload a file by specifying the destination folder for the file.
-// If the user provides a file name that already exists in the destination
-// folder, the user will receive an error.
-func (sdk *SDK) UploadFile(inFile interface{}, newFilename, folderID string) (*PathCollection, error) {
-	fileInputType := reflect.TypeOf(inFile)
-
-	var filename string
-	var contents []byte
-	if fileInputType.Name() == "" {
-		// Passed a file object.
-		contents = inFile.([]byte)
-	} else if fileInputType.Name() == "string" {
-		// Passed a filename rather than a file.
-		filename = inFile.(string)
-		file, err := os.Open(filename)
-		if err != nil {
-			log.Fatalln(err)
-			return nil, err
+// prepareFile rewinds f and returns its size and the upload options with its
+// SHA1 filled in.
+func prepareFile(f *os.File, opts *UploadOptions) (int64, *UploadOptions, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, nil, fmt.Errorf("box: reading upload: %w", err)
+	}
+	withSHA1 := UploadOptions{}
+	if opts != nil {
+		withSHA1 = *opts
+	}
+	if withSHA1.SHA1 == "" {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return 0, nil, fmt.Errorf("box: reading upload: %w", err)
 		}
-		defer file.Close()
-
-		contents, err = ioutil.ReadAll(file)
-		if err != nil {
-			log.Fatalln(err)
-			return nil, err
+		hash := sha1.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return 0, nil, fmt.Errorf("box: reading upload: %w", err)
 		}
+		withSHA1.SHA1 = hex.EncodeToString(hash.Sum(nil))
 	}
-
-	// Did not specify a new file name, so keep anme the same.
-	if newFilename == "" && filename != "" {
-		newFilename = filename
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, nil, fmt.Errorf("box: reading upload: %w", err)
 	}
+	return info.Size(), &withSHA1, nil
+}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	part, err := writer.CreateFormFile("file", newFilename)
+// uploadFileObject uploads content and returns the resulting file.
+func (sdk *SDK) uploadFileObject(ctx context.Context, url string, r io.Reader, size int64, fileName, folderID string, opts *UploadOptions, headers map[string]string) (*FileObject, error) {
+	response, err := sdk.upload(ctx, url, r, size, fileName, folderID, opts, headers)
 	if err != nil {
-		log.Fatalln(err)
 		return nil, err
 	}
-	part.Write(contents)
+	files := &fileCollection{}
+	if err := unmarshal(response, files); err != nil {
+		return nil, err
+	}
+	if len(files.Entries) == 0 {
+		return nil, errors.New("box: upload returned no file")
+	}
+	return files.Entries[0], nil
+}
 
-	fields := map[string]string{
-		"filename":   filename,
-		"attributes": `{"name":"` + newFilename + `","parent":{"id":"` + folderID + `"}}`,
+// upload streams a multipart upload of size bytes, or of unknown size if
+// size is negative, read from r to url. A seekable r is rewound for every
+// attempt and its size found if unknown. Uploads of known size are sent with
+// a Content-Length; others are sent chunked.
+func (sdk *SDK) upload(ctx context.Context, url string, r io.Reader, size int64, fileName, folderID string, opts *UploadOptions, headers map[string]string) ([]byte, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
 	}
 
-	for field, value := range fields {
-		err = writer.WriteField(field, value)
+	var start int64
+	var err error
+	seeker, seekable := r.(io.Seeker)
+	if seekable {
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seekable = false
+		}
+	}
+	if size < 0 && seekable {
+		end, err := seeker.Seek(0, io.SeekEnd)
 		if err != nil {
-			log.Fatalln(err)
+			return nil, fmt.Errorf("box: reading upload: %w", err)
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("box: reading upload: %w", err)
+		}
+		size = end - start
+	}
+
+	if folderID != "" {
+		preflightSize := size
+		if preflightSize < 0 {
+			preflightSize = 0
+		}
+		if err := sdk.preflight(ctx, fileName, folderID, preflightSize); err != nil {
 			return nil, err
 		}
 	}
 
-	err = writer.Close()
+	attributes, err := json.Marshal(newUploadAttributes(fileName, folderID, opts))
+	if err != nil {
+		return nil, fmt.Errorf("box: encoding upload attributes: %w", err)
+	}
+	boundary, head, tail, err := multipartFrame(attributes, fileName)
 	if err != nil {
-		log.Fatalln(err)
 		return nil, err
 	}
 
-	headers := map[string]string{
-		"Content-Type":   writer.FormDataContentType(),
-		"Content-Length": string(body.Len()),
+	// stop ends the stream of the previous attempt, so that r is no longer
+	// read when it is rewound or the upload returns.
+	var body *io.PipeReader
+	var done <-chan struct{}
+	stop := func() {
+		if body != nil {
+			body.Close()
+			<-done
+		}
+	}
+	defer stop()
+	source := &bodySource{open: func() (io.Reader, error) {
+		if body != nil {
+			if !seekable {
+				return nil, errNotReplayable
+			}
+			stop()
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("box: rewinding upload: %w", err)
+			}
+		}
+		body, done = multipartStream(head, tail, r)
+		if size < 0 {
+			return body, nil
+		}
+		return &sizedBody{Reader: body, size: int64(len(head)) + size + int64(len(tail))}, nil
+	}}
+
+	allHeaders := map[string]string{"Content-Type": "multipart/form-data; boundary=" + boundary}
+	if opts.SHA1 != "" {
+		allHeaders["Content-MD5"] = opts.SHA1
+	}
+	for k, v := range headers {
+		allHeaders[k] = v
 	}
+	return sdk.request(ctx, "POST", url, source, allHeaders)
+}
+
+// multipartFrame returns the boundary of a multipart upload body with the
+// attributes followed by a file part, and the bytes written before and after
+// the file's content.
+func multipartFrame(attributes []byte, fileName string) (boundary string, head, tail []byte, err error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	// Box requires the attributes before the file.
+	if err := writer.WriteField("attributes", string(attributes)); err != nil {
+		return "", nil, nil, fmt.Errorf("box: encoding upload: %w", err)
+	}
+	// A part without a file name isn't a file, so versions that keep their
+	// name still need one; the attributes name the file.
+	if fileName == "" {
+		fileName = "file"
+	}
+	if _, err := writer.CreateFormFile("file", fileName); err != nil {
+		return "", nil, nil, fmt.Errorf("box: encoding upload: %w", err)
+	}
+	n := buf.Len()
+	if err := writer.Close(); err != nil {
+		return "", nil, nil, fmt.Errorf("box: encoding upload: %w", err)
+	}
+	data := buf.Bytes()
+	return writer.Boundary(), data[:n], data[n:], nil
+}
 
-	response, err := sdk.request("POST", uploadURL, body, headers)
+// multipartStream returns a reader producing a multipart upload body of
+// head, the content of r and tail, and a channel closed once r is no longer
+// read.
+func multipartStream(head, tail []byte, r io.Reader) (*io.PipeReader, <-chan struct{}) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := pw.Write(head)
+		if err == nil {
+			_, err = io.Copy(pw, r)
+		}
+		if err == nil {
+			_, err = pw.Write(tail)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, done
+}
+
+// UploadFile uses the Upload API to allow users to add a new file. inFile is
+// the content as a []byte, an io.Reader or an *os.File, or the path of the
+// file to upload as a string. If the user provides a file name that already
+// exists in the destination folder, the user will receive an error.
+//
+// Prefer the typed UploadFromReader, UploadFromFile and UploadFromPath,
+// which return the uploaded file.
+func (sdk *SDK) UploadFile(inFile interface{}, newFilename, folderID string) (*PathCollection, error) {
+	return sdk.UploadFileContext(context.Background(), inFile, newFilename, folderID)
+}
+
+// UploadFileContext is like UploadFile but uses ctx for its requests.
+func (sdk *SDK) UploadFileContext(ctx context.Context, inFile interface{}, newFilename, folderID string) (*PathCollection, error) {
+	var response []byte
+	var err error
+	switch in := inFile.(type) {
+	case []byte:
+		response, err = sdk.upload(ctx, sdk.uploadURL(), bytes.NewReader(in), int64(len(in)), newFilename, folderID, nil, nil)
+	case string:
+		file, openErr := os.Open(in)
+		if openErr != nil {
+			return nil, fmt.Errorf("box: opening upload: %w", openErr)
+		}
+		defer file.Close()
+		// Did not specify a new file name, so keep the name the same.
+		if newFilename == "" {
+			newFilename = filepath.Base(in)
+		}
+		response, err = sdk.uploadOSFile(ctx, file, newFilename, folderID)
+	case *os.File:
+		if newFilename == "" {
+			newFilename = filepath.Base(in.Name())
+		}
+		response, err = sdk.uploadOSFile(ctx, in, newFilename, folderID)
+	case io.Reader:
+		response, err = sdk.upload(ctx, sdk.uploadURL(), in, -1, newFilename, folderID, nil, nil)
+	default:
+		return nil, fmt.Errorf("box: cannot upload a %T", inFile)
+	}
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 
 	pathCollection := &PathCollection{}
-	json.Unmarshal(response, &pathCollection)
-
+	if err := unmarshal(response, pathCollection); err != nil {
+		return nil, err
+	}
 	return pathCollection, nil
 }
 
+// uploadOSFile uploads the content of f for UploadFile.
+func (sdk *SDK) uploadOSFile(ctx context.Context, f *os.File, fileName, folderID string) ([]byte, error) {
+	size, opts, err := prepareFile(f, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sdk.upload(ctx, sdk.uploadURL(), f, size, fileName, folderID, opts, nil)
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // FILE VERSION
 ///////////////////////////////////////////////////////////////////////////////
 
+// chunkedUploadSize is the size from which new versions are uploaded with an
+// upload session rather than in a single request.
+var chunkedUploadSize int64 = 50 << 20
+
 // UploadFileVersion : Uploading a new file version is performed in the same
 // way as uploading a file. This method is used to upload a new version of an
-// existing file in a user’s account.
-func (sdk *SDK) UploadFileVersion(fileID, newName string) {}
+// existing file in a user’s account. The content of size bytes is read from
+// r; content of at least 50MB is uploaded in parts with an upload session.
+// A negative size uploads content of unknown size in a single request. If
+// newName is set the file is also renamed, and if etag is set the upload
+// fails with a 412 Precondition Failed error when the file has changed.
+// opts.ContentModifiedAt and opts.SHA1 are sent as for UploadFromReader; an
+// upload session sends the SHA1 of the content it reads instead.
+func (sdk *SDK) UploadFileVersion(fileID string, r io.Reader, size int64, newName, etag string, opts *UploadOptions) (*FileObject, error) {
+	return sdk.UploadFileVersionContext(context.Background(), fileID, r, size, newName, etag, opts)
+}
+
+// UploadFileVersionContext is like UploadFileVersion but uses ctx for its
+// requests.
+func (sdk *SDK) UploadFileVersionContext(ctx context.Context, fileID string, r io.Reader, size int64, newName, etag string, opts *UploadOptions) (*FileObject, error) {
+	if size >= chunkedUploadSize {
+		s := sdk.NewSession()
+		s.IfMatch = etag
+		if opts != nil {
+			s.ContentModifiedAt = opts.ContentModifiedAt
+		}
+		if err := s.NewVersionContext(ctx, fileID, size, newName); err != nil {
+			return nil, err
+		}
+		fileObject, err := s.UploadContext(ctx, r)
+		if err != nil {
+			s.AbortContext(context.Background())
+			return nil, err
+		}
+		return fileObject, nil
+	}
+
+	var headers map[string]string
+	if etag != "" {
+		headers = map[string]string{"If-Match": etag}
+	}
+	url := baseURL(sdk.endpoints.Upload, defaultUploadURL) + "/files/" + fileID + "/content"
+	return sdk.uploadFileObject(ctx, url, r, size, newName, "", opts, headers)
+}
+
+// ListFileVersions lists the previous versions of a file, newest first. The
+// current version is not included. Versions can be downloaded by setting
+// DownloadOptions.Version.
+func (sdk *SDK) ListFileVersions(fileID string, offset, limit int) (*FileVersionList, error) {
+	return sdk.ListFileVersionsContext(context.Background(), fileID, offset, limit)
+}
+
+// ListFileVersionsContext is like ListFileVersions but uses ctx for its
+// requests.
+func (sdk *SDK) ListFileVersionsContext(ctx context.Context, fileID string, offset, limit int) (*FileVersionList, error) {
+	opts := "?offset=" + strconv.Itoa(offset) + "&limit=" + strconv.Itoa(limit)
+	response, err := sdk.request(ctx, "GET", sdk.fileURL()+fileID+"/versions"+opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	versionList := &FileVersionList{}
+	if err := unmarshal(response, versionList); err != nil {
+		return nil, err
+	}
+	return versionList, nil
+}
+
+// GetFileVersion gets information about a version of a file.
+func (sdk *SDK) GetFileVersion(fileID, versionID string) (*FileVersion, error) {
+	return sdk.GetFileVersionContext(context.Background(), fileID, versionID)
+}
+
+// GetFileVersionContext is like GetFileVersion but uses ctx for its requests.
+func (sdk *SDK) GetFileVersionContext(ctx context.Context, fileID, versionID string) (*FileVersion, error) {
+	response, err := sdk.request(ctx, "GET", sdk.fileURL()+fileID+"/versions/"+versionID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalVersion(response)
+}
+
+// PromoteFileVersion makes a copy of a previous version the current version
+// of the file, and returns the new current version.
+func (sdk *SDK) PromoteFileVersion(fileID, versionID string) (*FileVersion, error) {
+	return sdk.PromoteFileVersionContext(context.Background(), fileID, versionID)
+}
+
+// PromoteFileVersionContext is like PromoteFileVersion but uses ctx for its
+// requests.
+func (sdk *SDK) PromoteFileVersionContext(ctx context.Context, fileID, versionID string) (*FileVersion, error) {
+	payload, err := json.Marshal(map[string]string{"type": "file_version", "id": versionID})
+	if err != nil {
+		return nil, fmt.Errorf("box: encoding version: %w", err)
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	response, err := sdk.request(ctx, "POST", sdk.fileURL()+fileID+"/versions/current", bytes.NewReader(payload), headers)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalVersion(response)
+}
+
+// DeleteFileVersion moves a previous version of a file to the trash, from
+// where it can be restored with RestoreFileVersion until it is purged. If
+// etag is set the version is only deleted if the file still matches it.
+func (sdk *SDK) DeleteFileVersion(fileID, versionID, etag string) error {
+	return sdk.DeleteFileVersionContext(context.Background(), fileID, versionID, etag)
+}
+
+// DeleteFileVersionContext is like DeleteFileVersion but uses ctx for its
+// requests.
+func (sdk *SDK) DeleteFileVersionContext(ctx context.Context, fileID, versionID, etag string) error {
+	var headers map[string]string
+	if etag != "" {
+		headers = map[string]string{"If-Match": etag}
+	}
+	_, err := sdk.request(ctx, "DELETE", sdk.fileURL()+fileID+"/versions/"+versionID, nil, headers)
+	return err
+}
+
+// RestoreFileVersion restores a trashed version of a file.
+func (sdk *SDK) RestoreFileVersion(fileID, versionID string) (*FileVersion, error) {
+	return sdk.RestoreFileVersionContext(context.Background(), fileID, versionID)
+}
+
+// RestoreFileVersionContext is like RestoreFileVersion but uses ctx for its
+// requests.
+func (sdk *SDK) RestoreFileVersionContext(ctx context.Context, fileID, versionID string) (*FileVersion, error) {
+	headers := map[string]string{"Content-Type": "application/json"}
+	body := bytes.NewBufferString(`{"trashed_at":null}`)
+	response, err := sdk.request(ctx, "PUT", sdk.fileURL()+fileID+"/versions/"+versionID, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalVersion(response)
+}
+
+// unmarshalVersion decodes a file version response.
+func unmarshalVersion(response []byte) (*FileVersion, error) {
+	version := &FileVersion{}
+	if err := unmarshal(response, version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
 
 ///////////////////////////////////////////////////////////////////////////////
-// UPLOAD (CUNKED)
+// PREFLIGHT
 ///////////////////////////////////////////////////////////////////////////////
 
-// Session TODO: Add definition
-type Session struct {
-	sessionID string
-	fileSize  int32
-}
+// PreflightStatus is the outcome of a preflight check.
+type PreflightStatus int
 
-// NewFile TODO: Add definition
-func (s *Session) NewFile(folderID string, fileSize int32, fileName string) {}
+// Outcomes of a preflight check.
+const (
+	PreflightOK PreflightStatus = iota
+	PreflightConflict
+	PreflightQuotaExceeded
+	PreflightForbidden
+)
 
-// NewVersion TODO: Add definition
-func (s *Session) NewVersion(folderID string, fileSize int32, fileName string) {}
+// PreflightResult : The result of checking whether a file can be uploaded.
+type PreflightResult struct {
+	Status PreflightStatus `json:"-"`
 
-// UploadPart TODO: Add definition
-func (s *Session) UploadPart() {}
+	// UploadURL is the URL Box suggests uploading the file to.
+	UploadURL string `json:"upload_url"`
 
-// ListParts TODO: Add definition
-func (s *Session) ListParts(offset int, limit int) {}
+	// ConflictID is the ID of the existing file with the same name, for
+	// PreflightConflict.
+	ConflictID string `json:"-"`
 
-// CommitUpload TODO: Add definition
-func (s *Session) CommitUpload(partID string, offset int, size int32) {}
+	// Err is the error Box returned when the upload would not be accepted.
+	Err *APIError `json:"-"`
+}
 
-// Abort TODO: Add definition
-func (s *Session) Abort() {}
+// OK reports whether the upload would be accepted.
+func (r *PreflightResult) OK() bool {
+	return r.Status == PreflightOK
+}
+
+// PreflightCheck checks whether a file called name of size bytes would be
+// accepted in the folder with ID parentID, without sending its content. A
+// rejected upload is reported in the result; the error is only set when the
+// check itself fails.
+func (sdk *SDK) PreflightCheck(name string, parentID string, size int64) (*PreflightResult, error) {
+	return sdk.PreflightCheckContext(context.Background(), name, parentID, size)
+}
+
+// PreflightCheckContext is like PreflightCheck but uses ctx for its requests.
+func (sdk *SDK) PreflightCheckContext(ctx context.Context, name string, parentID string, size int64) (*PreflightResult, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"name":   name,
+		"parent": map[string]string{"id": parentID},
+		"size":   size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("box: encoding preflight check: %w", err)
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	response, err := sdk.request(ctx, "OPTIONS", sdk.fileURL()+"content", bytes.NewReader(payload), headers)
+	var apiErr *APIError
+	switch {
+	case err == nil:
+		result := &PreflightResult{Status: PreflightOK}
+		if err := unmarshal(response, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	case !errors.As(err, &apiErr):
+		return nil, err
+	case apiErr.StatusCode == http.StatusConflict:
+		result := &PreflightResult{Status: PreflightConflict, Err: apiErr}
+		if item := apiErr.ConflictingItem(); item != nil {
+			result.ConflictID = item.ID
+		}
+		return result, nil
+	case apiErr.StatusCode == http.StatusForbidden && apiErr.Code == "storage_limit_exceeded":
+		return &PreflightResult{Status: PreflightQuotaExceeded, Err: apiErr}, nil
+	case apiErr.StatusCode == http.StatusForbidden:
+		return &PreflightResult{Status: PreflightForbidden, Err: apiErr}, nil
+	}
+	return nil, err
+}
+
+// preflight runs a preflight check before an upload, if enabled, and returns
+// Box's error if the upload would be rejected.
+func (sdk *SDK) preflight(ctx context.Context, name string, parentID string, size int64) error {
+	if !sdk.uploadPreflight {
+		return nil
+	}
+	result, err := sdk.PreflightCheckContext(ctx, name, parentID, size)
+	if err != nil {
+		return err
+	}
+	if !result.OK() {
+		return result.Err
+	}
+	return nil
+}
 
-// PreflightCheck TODO: Add definition
-func PreflightCheck(name string, parentID string, size int32) bool {
-	return true
+// SetUploadPreflight makes UploadFile run a preflight check before sending
+// the file, so that a rejected upload fails before any content is sent.
+func (sdk *SDK) SetUploadPreflight(enabled bool) {
+	sdk.uploadPreflight = enabled
 }
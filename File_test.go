@@ -1,26 +1,545 @@
 package box
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/ghostofcookie/gobox/boxtest"
 )
 
 func TestCreateDeleteFile(t *testing.T) {
 	t.Run("TestValidConfig", func(t *testing.T) {
-		sdk := setup()
+		sdk, srv := setup()
+		defer srv.Close()
 		err := sdk.RequestAccessToken()
 		if err != nil {
-			t.Error("Expected config to have been set")
+			t.Fatal("Expected config to have been set")
 		}
 		collection, err := sdk.UploadFile("File_test.go", "TestFile", "0")
 		if err != nil {
-			t.Error("Expected to receive Path Collection info")
+			t.Fatal("Expected to receive Path Collection info, got", err)
+		}
+		if len(collection.Entries) != 1 || collection.Entries[0].Name != "TestFile" {
+			t.Fatal("Expected the uploaded file in the collection")
+		}
+
+		want, _ := ioutil.ReadFile("File_test.go")
+		got, ok := srv.Content(collection.Entries[0].ID)
+		if !ok || !bytes.Equal(got, want) {
+			t.Error("Expected the uploaded content to match File_test.go")
+		}
+
+		err = sdk.DeleteFile(collection.Entries[0].ID, "0")
+		if err != nil {
+			t.Error("Expected no error from delete")
+		}
+		if srv.Exists(collection.Entries[0].ID) {
+			t.Error("Expected the file to have been deleted")
+		}
+	})
+
+	t.Run("TestUploadBytes", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.RequestAccessToken()
+		collection, err := sdk.UploadFile([]byte("hello"), "hello.txt", "0")
+		if err != nil || len(collection.Entries) != 1 {
+			t.Fatal("Expected to upload bytes, got", err)
+		}
+		if got, _ := srv.Content(collection.Entries[0].ID); string(got) != "hello" {
+			t.Errorf("Expected content %q, got %q", "hello", got)
+		}
+	})
+
+	t.Run("TestDeleteStaleEtag", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.RequestAccessToken()
+		id := srv.AddFile(boxtest.RootID, "a.txt", []byte("a"))
+		if err := sdk.DeleteFile(id, "7"); err == nil {
+			t.Error("Expected a precondition error")
+		}
+		if !srv.Exists(id) {
+			t.Error("Expected the file to still exist")
+		}
+	})
+}
+
+func TestGetFileInfo(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	sdk.RequestAccessToken()
+	folderID := srv.AddFolder(boxtest.RootID, "docs")
+	id := srv.AddFile(folderID, "a.txt", []byte("abc"))
+
+	file, err := sdk.GetFileInfo(id)
+	if err != nil {
+		t.Fatal("Expected file info, got", err)
+	}
+	if file.Name != "a.txt" || file.Size != 3 || file.Parent.ID != folderID {
+		t.Errorf("Unexpected file info %+v", file.Item)
+	}
+	if file.Sha1 != "a9993e364706816aba3e25717850c26c9cd0d89d" {
+		t.Error("Expected the SHA1 of the content, got", file.Sha1)
+	}
+
+	if _, err := sdk.GetFileInfo("404"); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	sdk.RequestAccessToken()
+	folderID := srv.AddFolder(boxtest.RootID, "dest")
+	id := srv.AddFile(boxtest.RootID, "a.txt", []byte("abc"))
+
+	file, err := sdk.CopyFile(id, folderID, "b.txt", "")
+	if err != nil {
+		t.Fatal("Expected the copy to succeed, got", err)
+	}
+	if file.ID == id || file.Name != "b.txt" || file.Parent.ID != folderID {
+		t.Errorf("Unexpected copy %+v", file.Item)
+	}
+	if got, _ := srv.Content(file.ID); string(got) != "abc" {
+		t.Error("Expected the copy to have the same content")
+	}
+
+	if _, err := sdk.CopyFile(id, folderID, "b.txt", ""); err == nil {
+		t.Error("Expected a name conflict")
+	}
+}
+
+func TestPreflightCheck(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	existing := srv.AddFile(boxtest.RootID, "taken.txt", []byte("data"))
+
+	t.Run("TestOK", func(t *testing.T) {
+		result, err := sdk.PreflightCheck("new.txt", boxtest.RootID, 10)
+		if err != nil || !result.OK() || result.UploadURL == "" {
+			t.Error("Expected the upload to be accepted, got", result, err)
+		}
+	})
+
+	t.Run("TestConflict", func(t *testing.T) {
+		result, err := sdk.PreflightCheck("taken.txt", boxtest.RootID, 10)
+		if err != nil || result.Status != PreflightConflict || result.ConflictID != existing {
+			t.Error("Expected a name conflict with the existing file, got", result, err)
+		}
+	})
+
+	t.Run("TestQuotaExceeded", func(t *testing.T) {
+		srv.Quota = 100
+		defer func() { srv.Quota = 0 }()
+		result, err := sdk.PreflightCheck("new.txt", boxtest.RootID, 1000)
+		if err != nil || result.Status != PreflightQuotaExceeded {
+			t.Error("Expected the quota to be exceeded, got", result, err)
+		}
+	})
+
+	t.Run("TestForbidden", func(t *testing.T) {
+		folderID := srv.AddFolder(boxtest.RootID, "Shared")
+		srv.SetReadOnly(folderID)
+		result, err := sdk.PreflightCheck("new.txt", folderID, 10)
+		if err != nil || result.Status != PreflightForbidden {
+			t.Error("Expected insufficient permissions, got", result, err)
 		}
+	})
+
+	t.Run("TestUploadFile", func(t *testing.T) {
+		sdk.SetUploadPreflight(true)
+		defer sdk.SetUploadPreflight(false)
+		requests := srv.Requests()
+		_, err := sdk.UploadFile([]byte("content"), "taken.txt", boxtest.RootID)
+		if !IsConflict(err) || ConflictingItem(err).ID != existing {
+			t.Error("Expected the preflight conflict, got", err)
+		}
+		if srv.Requests() != requests+1 {
+			t.Error("Expected the content not to be sent")
+		}
+	})
+}
 
-		if len(collection.Entries) > 0 {
-			err = sdk.DeleteFile(collection.Entries[0].ID, "0")
-			if err != nil {
-				t.Error("Expected no error from delete")
+func TestUploadFrom(t *testing.T) {
+	content := []byte("streamed upload content")
+	sum := sha1.Sum(content)
+	contentSHA1 := hex.EncodeToString(sum[:])
+
+	t.Run("TestReader", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+
+		created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		file, err := sdk.UploadFromReader(bytes.NewReader(content), `a "quoted" name.txt`, boxtest.RootID,
+			&UploadOptions{ContentCreatedAt: created, ContentModifiedAt: created, SHA1: contentSHA1})
+		if err != nil {
+			t.Fatal("Expected the upload to succeed, got", err)
+		}
+		if file.Name != `a "quoted" name.txt` || file.ContentCreatedAt != "2020-01-02T03:04:05Z" {
+			t.Error("Expected the uploaded file's attributes, got", file.Name, file.ContentCreatedAt)
+		}
+		if got, _ := srv.Content(file.ID); !bytes.Equal(got, content) {
+			t.Error("Expected the uploaded content, got", string(got))
+		}
+	})
+
+	t.Run("TestContentLength", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		dir, err := ioutil.TempDir("", "box")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "path.txt")
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		uploads := map[string]func() error{
+			"bytes": func() error {
+				_, err := sdk.UploadFile(content, "bytes.txt", boxtest.RootID)
+				return err
+			},
+			"path": func() error {
+				_, err := sdk.UploadFromPath(path, "", boxtest.RootID, nil)
+				return err
+			},
+			"reader": func() error {
+				_, err := sdk.UploadFromReader(bytes.NewReader(content), "reader.txt", boxtest.RootID, nil)
+				return err
+			},
+		}
+		for name, upload := range uploads {
+			if err := upload(); err != nil {
+				t.Fatalf("Expected the %s upload to succeed, got %v", name, err)
+			}
+			if got := srv.LastContentLength(); got <= int64(len(content)) {
+				t.Errorf("Expected the %s upload to have a Content-Length, got %d", name, got)
 			}
 		}
+
+		stream := io.MultiReader(bytes.NewReader(content))
+		if _, err := sdk.UploadFromReader(stream, "stream.txt", boxtest.RootID, nil); !hasStatus(err, http.StatusLengthRequired) {
+			t.Error("Expected a stream of unknown size to be sent chunked, got", err)
+		}
+	})
+
+	t.Run("TestSHA1Mismatch", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+
+		_, err := sdk.UploadFromReader(bytes.NewReader(content), "bad.txt", boxtest.RootID,
+			&UploadOptions{SHA1: strings.Repeat("0", 40)})
+		if !hasStatus(err, http.StatusPreconditionFailed) {
+			t.Error("Expected the upload to be rejected, got", err)
+		}
+	})
+
+	t.Run("TestPath", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+
+		dir, err := ioutil.TempDir("", "box")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "local.txt")
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := sdk.UploadFromPath(path, "", boxtest.RootID, nil)
+		if err != nil {
+			t.Fatal("Expected the upload to succeed, got", err)
+		}
+		if file.Name != "local.txt" || srv.LastHeader().Get("Content-MD5") != contentSHA1 {
+			t.Error("Expected the file to be uploaded under its name with its SHA1")
+		}
+	})
+
+	t.Run("TestRetrySeekable", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, RetryNonIdempotent: true})
+		if err := sdk.RequestAccessToken(); err != nil {
+			t.Fatal(err)
+		}
+
+		srv.FailNext(1, http.StatusServiceUnavailable, 0)
+		file, err := sdk.UploadFromReader(bytes.NewReader(content), "retried.txt", boxtest.RootID, nil)
+		if err != nil {
+			t.Fatal("Expected the upload to be retried, got", err)
+		}
+		if got, _ := srv.Content(file.ID); !bytes.Equal(got, content) {
+			t.Error("Expected the uploaded content, got", string(got))
+		}
+	})
+
+	t.Run("TestNoRetryStream", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, RetryNonIdempotent: true})
+		if err := sdk.RequestAccessToken(); err != nil {
+			t.Fatal(err)
+		}
+
+		srv.FailNext(1, http.StatusServiceUnavailable, 0)
+		stream := io.MultiReader(bytes.NewReader(content))
+		if _, err := sdk.UploadFromReader(stream, "stream.txt", boxtest.RootID, nil); !hasStatus(err, http.StatusServiceUnavailable) {
+			t.Error("Expected the original error for a stream that cannot be replayed, got", err)
+		}
+	})
+
+	t.Run("TestUnsupportedType", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		if _, err := sdk.UploadFile(42, "number.txt", boxtest.RootID); err == nil {
+			t.Error("Expected an unsupported type to be rejected")
+		}
+	})
+}
+
+func TestUploadFileVersion(t *testing.T) {
+	t.Run("TestRename", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		fileID := srv.AddFile(boxtest.RootID, "doc.txt", []byte("v1"))
+
+		file, err := sdk.UploadFileVersion(fileID, strings.NewReader("v2"), 2, "doc-v2.txt", "0", nil)
+		if err != nil {
+			t.Fatal("Expected the version to upload, got", err)
+		}
+		if file.ID != fileID || file.Name != "doc-v2.txt" || file.FileVersion == nil || file.Etag != "1" {
+			t.Error("Expected the renamed file with its new version, got", file)
+		}
+		if got, _ := srv.Content(fileID); string(got) != "v2" {
+			t.Error("Expected the new content, got", string(got))
+		}
+	})
+
+	t.Run("TestOptions", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		fileID := srv.AddFile(boxtest.RootID, "doc.txt", []byte("v1"))
+
+		sum := sha1.Sum([]byte("v2"))
+		modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		file, err := sdk.UploadFileVersion(fileID, strings.NewReader("v2"), 2, "", "",
+			&UploadOptions{ContentModifiedAt: modified, SHA1: hex.EncodeToString(sum[:])})
+		if err != nil {
+			t.Fatal("Expected the version to upload, got", err)
+		}
+		if file.Name != "doc.txt" || file.ContentModifiedAt != "2020-01-02T03:04:05Z" {
+			t.Error("Expected the file's name and content modification time, got", file.Name, file.ContentModifiedAt)
+		}
+		if got := srv.LastContentLength(); got <= 2 {
+			t.Error("Expected the upload to have a Content-Length, got", got)
+		}
+
+		_, err = sdk.UploadFileVersion(fileID, strings.NewReader("v3"), 2, "", "",
+			&UploadOptions{SHA1: hex.EncodeToString(sum[:])})
+		if !IsPreconditionFailed(err) {
+			t.Error("Expected a SHA1 mismatch to be rejected, got", err)
+		}
+	})
+
+	t.Run("TestEtagMismatch", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		fileID := srv.AddFile(boxtest.RootID, "doc.txt", []byte("v1"))
+		srv.SetContent(fileID, []byte("concurrent edit"))
+
+		_, err := sdk.UploadFileVersion(fileID, strings.NewReader("v2"), 2, "", "0", nil)
+		if !IsPreconditionFailed(err) {
+			t.Error("Expected the upload to be rejected, got", err)
+		}
+		if got, _ := srv.Content(fileID); string(got) != "concurrent edit" {
+			t.Error("Expected the concurrent edit to be kept, got", string(got))
+		}
+	})
+
+	t.Run("TestChunked", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+		fileID := srv.AddFile(boxtest.RootID, "big.bin", []byte("v1"))
+
+		defer func(size int64) { chunkedUploadSize = size }(chunkedUploadSize)
+		chunkedUploadSize = 32
+		file, err := sdk.UploadFileVersion(fileID, bytes.NewReader(sessionContent), int64(len(sessionContent)), "", "0", nil)
+		if err != nil {
+			t.Fatal("Expected the version to upload, got", err)
+		}
+		if got, _ := srv.Content(file.ID); file.ID != fileID || !bytes.Equal(got, sessionContent) {
+			t.Error("Expected the new content, got", string(got))
+		}
+
+		modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		file, err = sdk.UploadFileVersion(fileID, bytes.NewReader(sessionContent), int64(len(sessionContent)), "", "1",
+			&UploadOptions{ContentModifiedAt: modified})
+		if err != nil {
+			t.Fatal("Expected the version to upload, got", err)
+		}
+		if file.ContentModifiedAt != "2020-01-02T03:04:05Z" {
+			t.Error("Expected the content modification time to be committed, got", file.ContentModifiedAt)
+		}
+
+		_, err = sdk.UploadFileVersion(fileID, bytes.NewReader(sessionContent), int64(len(sessionContent)), "", "0", nil)
+		if !IsPreconditionFailed(err) || srv.Sessions() != 0 {
+			t.Error("Expected a stale etag to fail the commit and abort the session, got", err)
+		}
+	})
+}
+
+func TestFileVersions(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	fileID := srv.AddFile(boxtest.RootID, "doc.txt", []byte("v1"))
+	srv.SetContent(fileID, []byte("v2"))
+	srv.SetContent(fileID, []byte("v3"))
+
+	list, err := sdk.ListFileVersions(fileID, 0, 100)
+	if err != nil {
+		t.Fatal("Expected the versions to be listed, got", err)
+	}
+	if list.TotalCount != 2 || len(list.Entries) != 2 || list.Entries[1].Size != 2 {
+		t.Fatal("Expected the two previous versions, got", list)
+	}
+	first := list.Entries[1]
+
+	t.Run("TestGetAndDownload", func(t *testing.T) {
+		version, err := sdk.GetFileVersion(fileID, first.ID)
+		if err != nil || version.Sha1 != first.Sha1 {
+			t.Error("Expected the version, got", version, err)
+		}
+		var buf bytes.Buffer
+		_, err = sdk.DownloadTo(fileID, &buf, &DownloadOptions{Version: first.ID, SHA1: first.Sha1})
+		if err != nil || buf.String() != "v1" {
+			t.Error("Expected the version's content, got", buf.String(), err)
+		}
+
+		// Without a SHA1 the version's own is used.
+		buf.Reset()
+		_, err = sdk.DownloadTo(fileID, &buf, &DownloadOptions{Version: first.ID})
+		if err != nil || buf.String() != "v1" {
+			t.Error("Expected the verified version's content, got", buf.String(), err)
+		}
+	})
+
+	t.Run("TestDeleteAndRestore", func(t *testing.T) {
+		if err := sdk.DeleteFileVersion(fileID, first.ID, ""); err != nil {
+			t.Fatal("Expected the version to be trashed, got", err)
+		}
+		if version, err := sdk.GetFileVersion(fileID, first.ID); err != nil || version.TrashedAt == "" {
+			t.Error("Expected the version to be in the trash, got", version, err)
+		}
+		if _, err := sdk.DownloadTo(fileID, ioutil.Discard, &DownloadOptions{Version: first.ID}); !IsNotFound(err) {
+			t.Error("Expected a trashed version not to download, got", err)
+		}
+
+		version, err := sdk.RestoreFileVersion(fileID, first.ID)
+		if err != nil || version.TrashedAt != "" || version.RestoredAt == "" {
+			t.Error("Expected the version to be restored, got", version, err)
+		}
+	})
+
+	t.Run("TestPromote", func(t *testing.T) {
+		version, err := sdk.PromoteFileVersion(fileID, first.ID)
+		if err != nil || version.ID == first.ID || version.Sha1 != first.Sha1 {
+			t.Fatal("Expected a new current version with the old content, got", version, err)
+		}
+		if got, _ := srv.Content(fileID); string(got) != "v1" {
+			t.Error("Expected the promoted content, got", string(got))
+		}
+		if list, err := sdk.ListFileVersions(fileID, 0, 100); err != nil || list.TotalCount != 3 {
+			t.Error("Expected the replaced version in the history, got", list, err)
+		}
+	})
+}
+
+func TestUpdateFile(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	folderID := srv.AddFolder(boxtest.RootID, "Archive")
+	fileID := srv.AddFile(boxtest.RootID, "report.txt", []byte("data"))
+	srv.AddFile(folderID, "taken.txt", []byte("data"))
+
+	t.Run("TestRenameAndMove", func(t *testing.T) {
+		file, err := sdk.UpdateFile(fileID, &FileUpdate{Name: "report-2020.txt", ParentID: folderID}, "0")
+		if err != nil {
+			t.Fatal("Expected the file to be updated, got", err)
+		}
+		if file.Name != "report-2020.txt" || file.Parent == nil || file.Parent.ID != folderID || file.Etag != "1" {
+			t.Error("Expected the file to be renamed and moved, got", file)
+		}
+	})
+
+	t.Run("TestEtagMismatch", func(t *testing.T) {
+		_, err := sdk.UpdateFile(fileID, &FileUpdate{Name: "stale.txt"}, "0")
+		if !IsPreconditionFailed(err) {
+			t.Error("Expected the update to be rejected, got", err)
+		}
+	})
+
+	t.Run("TestNilUpdate", func(t *testing.T) {
+		file, err := sdk.UpdateFile(fileID, nil, "")
+		if err != nil {
+			t.Fatal("Expected a nil update to succeed, got", err)
+		}
+		if file.Name != "report-2020.txt" {
+			t.Error("Expected the file to be unchanged, got", file.Name)
+		}
+	})
+
+	t.Run("TestConflict", func(t *testing.T) {
+		_, err := sdk.UpdateFile(fileID, &FileUpdate{Name: "taken.txt"}, "")
+		if !IsConflict(err) {
+			t.Error("Expected a name conflict, got", err)
+		}
+	})
+
+	t.Run("TestAttributes", func(t *testing.T) {
+		description := "Quarterly report"
+		expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		canDownload := false
+		file, err := sdk.UpdateFile(fileID, &FileUpdate{
+			Description:   &description,
+			Tags:          []string{"finance", "q1"},
+			Lock:          &LockUpdate{ExpiresAt: expires, IsDownloadPrevented: true},
+			SharedLink:    &SharedLinkUpdate{Access: "company", Permissions: &SharedLinkPermissions{CanDownload: &canDownload}},
+			CollectionIDs: []string{"1"},
+		}, "")
+		if err != nil {
+			t.Fatal("Expected the file to be updated, got", err)
+		}
+		if file.Description != description || len(file.Tags) != 2 {
+			t.Error("Expected the description and tags, got", file.Description, file.Tags)
+		}
+		if file.Lock == nil || file.Lock.ExpiresAt != "2030-01-01T00:00:00Z" || !file.Lock.IsDownloadPrevented {
+			t.Error("Expected the file to be locked, got", file.Lock)
+		}
+		if file.SharedLink == nil || file.SharedLink.URL == "" || file.SharedLink.Access != "company" {
+			t.Error("Expected a shared link, got", file.SharedLink)
+		}
+
+		file, err = sdk.UpdateFile(fileID, &FileUpdate{Unlock: true, RemoveSharedLink: true, Tags: []string{}}, "")
+		if err != nil {
+			t.Fatal("Expected the file to be updated, got", err)
+		}
+		if file.Lock != nil || file.SharedLink != nil || len(file.Tags) != 0 {
+			t.Error("Expected the lock, shared link and tags to be removed, got", file)
+		}
 	})
 }
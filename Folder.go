@@ -2,84 +2,203 @@ package box
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
 	"strconv"
 	"strings"
 )
 
-const folderURL = "https://api.box.com/2.0/folders/"
-
 // GetFolderInfo gets the information for the requested folder ID
 func (sdk *SDK) GetFolderInfo(folderID string) (*FolderObject, error) {
-	response, err := sdk.request("GET", folderURL+folderID, nil, nil)
+	return sdk.GetFolderInfoContext(context.Background(), folderID)
+}
+
+// GetFolderInfoContext is like GetFolderInfo but uses ctx for its requests.
+func (sdk *SDK) GetFolderInfoContext(ctx context.Context, folderID string) (*FolderObject, error) {
+	response, err := sdk.request(ctx, "GET", sdk.folderURL()+folderID, nil, nil)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 	folder := &FolderObject{}
-	json.Unmarshal(response, &folder)
-
+	if err := unmarshal(response, folder); err != nil {
+		return nil, err
+	}
 	return folder, nil
 }
 
 // ListItemsInFolder returns all the items contained inside the folder with 'ID' folderID.
 func (sdk *SDK) ListItemsInFolder(folderID string, limit int, offset int) (*ItemCollection, error) {
+	return sdk.ListItemsInFolderContext(context.Background(), folderID, limit, offset)
+}
+
+// ListItemsInFolderContext is like ListItemsInFolder but uses ctx for its requests.
+func (sdk *SDK) ListItemsInFolderContext(ctx context.Context, folderID string, limit int, offset int) (*ItemCollection, error) {
 	urlOpts := "/items?limit=" + strconv.Itoa(limit) + "&offset=" + strconv.Itoa(offset)
-	response, err := sdk.request("GET", folderURL+folderID+urlOpts, nil, nil)
+	response, err := sdk.request(ctx, "GET", sdk.folderURL()+folderID+urlOpts, nil, nil)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 	items := &ItemCollection{}
-	json.Unmarshal(response, &items)
-
+	if err := unmarshal(response, items); err != nil {
+		return nil, err
+	}
 	return items, nil
 }
 
 // CreateFolder creates a new folder under the parent folder that has 'ID' parentFolderID.
 func (sdk *SDK) CreateFolder(name string, parentFolderID string) (*FolderObject, error) {
+	return sdk.CreateFolderContext(context.Background(), name, parentFolderID)
+}
+
+// CreateFolderContext is like CreateFolder but uses ctx for its requests.
+func (sdk *SDK) CreateFolderContext(ctx context.Context, name string, parentFolderID string) (*FolderObject, error) {
 	body := strings.NewReader(`{"name":"` + name + `", "parent": {"id": "` + parentFolderID + `"}}`)
 
-	response, err := sdk.request("POST", folderURL, body, nil)
+	response, err := sdk.request(ctx, "POST", sdk.folderURL(), body, nil)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 	folderObject := &FolderObject{}
-	json.Unmarshal(response, &folderObject)
-
+	if err := unmarshal(response, folderObject); err != nil {
+		return nil, err
+	}
 	return folderObject, nil
 }
 
 // CopyFolder copies a speified folder to a specified parent folder.
 func (sdk *SDK) CopyFolder(folderID string, parentFolderID string, newName string) (*FolderObject, error) {
+	return sdk.CopyFolderContext(context.Background(), folderID, parentFolderID, newName)
+}
+
+// CopyFolderContext is like CopyFolder but uses ctx for its requests.
+func (sdk *SDK) CopyFolderContext(ctx context.Context, folderID string, parentFolderID string, newName string) (*FolderObject, error) {
 	body := map[string]interface{}{"parent": map[string]string{"id": parentFolderID}}
 	if newName != "" {
 		body["name"] = newName
 	}
 	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("box: encoding copy request: %w", err)
+	}
 
 	headers := map[string]string{"Content-Type": "application/json"}
-	response, err := sdk.request("POST", folderURL+folderID+"/copy", bytes.NewBufferString(string(payload)), headers)
+	response, err := sdk.request(ctx, "POST", sdk.folderURL()+folderID+"/copy", bytes.NewBufferString(string(payload)), headers)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 	folderObject := &FolderObject{}
-	json.Unmarshal(response, &folderObject)
-
+	if err := unmarshal(response, folderObject); err != nil {
+		return nil, err
+	}
 	return folderObject, nil
 }
 
-// UpdateFolder updates a folder object.
-func (sdk *SDK) UpdateFolder() {}
+// FolderUpdate : The changes to make to a folder. Zero fields are left
+// unchanged.
+type FolderUpdate struct {
+	Name string
 
-// DeleteFolder deletes the folder who's 'ID' matches folderID.
-func (sdk *SDK) DeleteFolder(folderID string) {
-	_, err := sdk.request("DELETE", folderURL+folderID+"?recursive=true", nil, nil)
+	// ParentID moves the folder, with its contents, to another folder.
+	ParentID string
+
+	// Description and Tags replace the current values when not nil. An empty
+	// value clears them.
+	Description *string
+	Tags        []string
+
+	// SharedLink creates or changes the folder's shared link, and
+	// RemoveSharedLink removes it.
+	SharedLink       *SharedLinkUpdate
+	RemoveSharedLink bool
+
+	// FolderUploadEmail enables uploads by email, for "open" or
+	// "collaborators" access, and DisableUploadEmail disables them.
+	FolderUploadEmail  *FolderUploadEmail
+	DisableUploadEmail bool
+
+	// SyncState is "synced", "not_synced" or "partially_synced".
+	SyncState string
+
+	CanNonOwnersInvite                    *bool
+	IsCollaborationRestrictedToEnterprise *bool
+}
+
+// body returns the request body for the update.
+func (u *FolderUpdate) body() map[string]interface{} {
+	body := make(map[string]interface{})
+	if u.Name != "" {
+		body["name"] = u.Name
+	}
+	if u.ParentID != "" {
+		body["parent"] = map[string]string{"id": u.ParentID}
+	}
+	if u.Description != nil {
+		body["description"] = *u.Description
+	}
+	if u.Tags != nil {
+		body["tags"] = u.Tags
+	}
+	if u.SharedLink != nil {
+		body["shared_link"] = u.SharedLink
+	} else if u.RemoveSharedLink {
+		body["shared_link"] = nil
+	}
+	if u.FolderUploadEmail != nil {
+		body["folder_upload_email"] = map[string]string{"access": u.FolderUploadEmail.Access}
+	} else if u.DisableUploadEmail {
+		body["folder_upload_email"] = nil
+	}
+	if u.SyncState != "" {
+		body["sync_state"] = u.SyncState
+	}
+	if u.CanNonOwnersInvite != nil {
+		body["can_non_owners_invite"] = *u.CanNonOwnersInvite
+	}
+	if u.IsCollaborationRestrictedToEnterprise != nil {
+		body["is_collaboration_restricted_to_enterprise"] = *u.IsCollaborationRestrictedToEnterprise
+	}
+	return body
+}
+
+// UpdateFolder renames, moves or otherwise changes a folder. If etag is set
+// the update fails with a 412 Precondition Failed error when the folder has
+// changed since. A nil update leaves the folder unchanged.
+func (sdk *SDK) UpdateFolder(folderID string, update *FolderUpdate, etag string) (*FolderObject, error) {
+	return sdk.UpdateFolderContext(context.Background(), folderID, update, etag)
+}
+
+// UpdateFolderContext is like UpdateFolder but uses ctx for its requests.
+func (sdk *SDK) UpdateFolderContext(ctx context.Context, folderID string, update *FolderUpdate, etag string) (*FolderObject, error) {
+	if update == nil {
+		update = &FolderUpdate{}
+	}
+	payload, err := json.Marshal(update.body())
 	if err != nil {
-		log.Println(err)
-		return
+		return nil, fmt.Errorf("box: encoding folder update: %w", err)
 	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	if etag != "" {
+		headers["If-Match"] = etag
+	}
+	response, err := sdk.request(ctx, "PUT", sdk.folderURL()+folderID, bytes.NewReader(payload), headers)
+	if err != nil {
+		return nil, err
+	}
+	folderObject := &FolderObject{}
+	if err := unmarshal(response, folderObject); err != nil {
+		return nil, err
+	}
+	return folderObject, nil
+}
+
+// DeleteFolder deletes the folder who's 'ID' matches folderID.
+func (sdk *SDK) DeleteFolder(folderID string) error {
+	return sdk.DeleteFolderContext(context.Background(), folderID)
+}
+
+// DeleteFolderContext is like DeleteFolder but uses ctx for its requests.
+func (sdk *SDK) DeleteFolderContext(ctx context.Context, folderID string) error {
+	_, err := sdk.request(ctx, "DELETE", sdk.folderURL()+folderID+"?recursive=true", nil, nil)
+	return err
 }
@@ -2,6 +2,8 @@ package box
 
 import (
 	"testing"
+
+	"github.com/ghostofcookie/gobox/boxtest"
 )
 
 func TestGetFolderInfo(t *testing.T) {
@@ -14,14 +16,138 @@ func TestGetFolderInfo(t *testing.T) {
 	})
 
 	t.Run("TestValidConfig", func(t *testing.T) {
-		sdk := setup()
+		sdk, srv := setup()
+		defer srv.Close()
 		err := sdk.RequestAccessToken()
 		if err != nil {
 			t.Error("Expected config to have been set")
 		}
-		_, err = sdk.GetFolderInfo("0")
+		srv.AddFolder(boxtest.RootID, "docs")
+		folder, err := sdk.GetFolderInfo("0")
+		if err != nil {
+			t.Fatal("Expected to receive Folder info")
+		}
+		if folder.ItemCollection == nil || folder.ItemCollection.TotalCount != 1 {
+			t.Error("Expected the root folder to contain one item")
+		}
+	})
+}
+
+func TestListItemsInFolder(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	sdk.RequestAccessToken()
+	for _, name := range []string{"a", "b", "c"} {
+		srv.AddFile(boxtest.RootID, name, nil)
+	}
+
+	items, err := sdk.ListItemsInFolder("0", 2, 1)
+	if err != nil {
+		t.Fatal("Expected items, got", err)
+	}
+	if items.TotalCount != 3 || len(items.Entries) != 2 || items.Entries[0].Name != "b" {
+		t.Errorf("Unexpected page %+v", items)
+	}
+}
+
+func TestCreateCopyDeleteFolder(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	sdk.RequestAccessToken()
+
+	folder, err := sdk.CreateFolder("src", "0")
+	if err != nil {
+		t.Fatal("Expected the folder to be created, got", err)
+	}
+	srv.AddFile(folder.ID, "a.txt", []byte("a"))
+
+	if _, err := sdk.CreateFolder("src", "0"); err == nil {
+		t.Error("Expected a name conflict")
+	}
+
+	copied, err := sdk.CopyFolder(folder.ID, "0", "dst")
+	if err != nil {
+		t.Fatal("Expected the folder to be copied, got", err)
+	}
+	if copied.Name != "dst" || copied.ItemCollection.TotalCount != 1 {
+		t.Errorf("Unexpected copy %+v", copied)
+	}
+
+	if err := sdk.DeleteFolder(folder.ID); err != nil {
+		t.Error("Expected no error from delete, got", err)
+	}
+	if srv.Exists(folder.ID) {
+		t.Error("Expected the folder to have been deleted")
+	}
+}
+
+func TestUpdateFolder(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	archiveID := srv.AddFolder(boxtest.RootID, "Archive")
+	folderID := srv.AddFolder(boxtest.RootID, "Reports")
+	srv.AddFolder(archiveID, "Taken")
+
+	t.Run("TestRenameAndMove", func(t *testing.T) {
+		folder, err := sdk.UpdateFolder(folderID, &FolderUpdate{Name: "Reports 2020", ParentID: archiveID}, "0")
+		if err != nil {
+			t.Fatal("Expected the folder to be updated, got", err)
+		}
+		if folder.Name != "Reports 2020" || folder.Parent == nil || folder.Parent.ID != archiveID || folder.Etag != "1" {
+			t.Error("Expected the folder to be renamed and moved, got", folder)
+		}
+	})
+
+	t.Run("TestEtagMismatch", func(t *testing.T) {
+		if _, err := sdk.UpdateFolder(folderID, &FolderUpdate{Name: "Stale"}, "0"); !IsPreconditionFailed(err) {
+			t.Error("Expected the update to be rejected, got", err)
+		}
+	})
+
+	t.Run("TestNilUpdate", func(t *testing.T) {
+		folder, err := sdk.UpdateFolder(folderID, nil, "")
+		if err != nil {
+			t.Fatal("Expected a nil update to succeed, got", err)
+		}
+		if folder.Name != "Reports 2020" {
+			t.Error("Expected the folder to be unchanged, got", folder.Name)
+		}
+	})
+
+	t.Run("TestConflict", func(t *testing.T) {
+		if _, err := sdk.UpdateFolder(folderID, &FolderUpdate{Name: "Taken"}, ""); !IsConflict(err) {
+			t.Error("Expected a name conflict, got", err)
+		}
+	})
+
+	t.Run("TestMoveIntoItself", func(t *testing.T) {
+		if _, err := sdk.UpdateFolder(archiveID, &FolderUpdate{ParentID: folderID}, ""); err == nil {
+			t.Error("Expected a folder not to move into its own subfolder")
+		}
+	})
+
+	t.Run("TestAttributes", func(t *testing.T) {
+		restricted := true
+		folder, err := sdk.UpdateFolder(folderID, &FolderUpdate{
+			Tags:                                  []string{"finance"},
+			SyncState:                             "synced",
+			FolderUploadEmail:                     &FolderUploadEmail{Access: "collaborators"},
+			IsCollaborationRestrictedToEnterprise: &restricted,
+			SharedLink:                            &SharedLinkUpdate{Access: "open"},
+		}, "")
 		if err != nil {
-			t.Error("Expected to receive Folder info")
+			t.Fatal("Expected the folder to be updated, got", err)
+		}
+		if folder.SyncState != "synced" || len(folder.Tags) != 1 || !folder.IsCollaborationRestrictedToEnterprise {
+			t.Error("Expected the folder's settings, got", folder)
+		}
+		if folder.FolderUploadEmail == nil || folder.FolderUploadEmail.Email == "" || folder.SharedLink == nil {
+			t.Error("Expected an upload email and a shared link, got", folder.FolderUploadEmail, folder.SharedLink)
+		}
+
+		folder, err = sdk.UpdateFolder(folderID, &FolderUpdate{DisableUploadEmail: true, RemoveSharedLink: true}, "")
+		if err != nil || folder.FolderUploadEmail != nil || folder.SharedLink != nil {
+			t.Error("Expected the upload email and shared link to be removed, got", folder, err)
 		}
 	})
 }
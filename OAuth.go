@@ -0,0 +1,218 @@
+package box
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var errNoRefreshToken = errors.New("box: access token has expired and has no refresh token")
+
+// AuthCodeURL returns the URL that starts the OAuth 2.0 authorization code
+// flow. The user is sent back to redirectURI with a code and the given state,
+// which the caller must check before calling ExchangeCode. Scopes may be
+// omitted to request those configured for the app.
+func (sdk *SDK) AuthCodeURL(redirectURI, state string, scopes ...string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	if sdk.config != nil {
+		query.Set("client_id", sdk.config.BoxAppSettings.ClientID)
+	}
+	if redirectURI != "" {
+		query.Set("redirect_uri", redirectURI)
+	}
+	query.Set("state", state)
+	if len(scopes) > 0 {
+		query.Set("scope", strings.Join(scopes, " "))
+	}
+	return baseURL(sdk.endpoints.Authorize, defaultAuthURL) + "/authorize?" + query.Encode()
+}
+
+// ExchangeCode exchanges an authorization code for an access and refresh
+// token, and makes the SDK act as the user who authorized the app.
+func (sdk *SDK) ExchangeCode(code, redirectURI string) (*AccessTokenObject, error) {
+	return sdk.ExchangeCodeContext(context.Background(), code, redirectURI)
+}
+
+// ExchangeCodeContext is like ExchangeCode but uses ctx for its requests.
+func (sdk *SDK) ExchangeCodeContext(ctx context.Context, code, redirectURI string) (*AccessTokenObject, error) {
+	if sdk.config == nil {
+		return nil, errConfig
+	}
+	payload := url.Values{}
+	payload.Add("grant_type", "authorization_code")
+	payload.Add("code", code)
+	payload.Add("client_id", sdk.config.BoxAppSettings.ClientID)
+	payload.Add("client_secret", sdk.config.BoxAppSettings.ClientSecret)
+	if redirectURI != "" {
+		payload.Add("redirect_uri", redirectURI)
+	}
+
+	token, err := sdk.requestToken(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	sdk.SetToken(token)
+	if sdk.store != nil {
+		if err := sdk.store.Save(token); err != nil {
+			return nil, fmt.Errorf("box: saving token: %w", err)
+		}
+	}
+	return token, nil
+}
+
+// SetToken makes the SDK use a previously issued user token. It is refreshed
+// with its refresh token when it expires or is rejected. The token may be nil
+// when the SDK's TokenStore already holds the user's tokens.
+func (sdk *SDK) SetToken(token *AccessTokenObject) {
+	// Box issues a new refresh token on every refresh, so always use the one
+	// from the latest token.
+	sdk.useTokens(func(ctx context.Context, previous *AccessTokenObject) (*AccessTokenObject, error) {
+		if previous == nil || previous.RefreshToken == "" {
+			return nil, errNoRefreshToken
+		}
+		return sdk.refreshToken(ctx, previous.RefreshToken)
+	}).token = token
+}
+
+// refreshToken exchanges a refresh token for a new access token.
+func (sdk *SDK) refreshToken(ctx context.Context, refreshToken string) (*AccessTokenObject, error) {
+	if sdk.config == nil {
+		return nil, errConfig
+	}
+	payload := url.Values{}
+	payload.Add("grant_type", "refresh_token")
+	payload.Add("refresh_token", refreshToken)
+	payload.Add("client_id", sdk.config.BoxAppSettings.ClientID)
+	payload.Add("client_secret", sdk.config.BoxAppSettings.ClientSecret)
+	return sdk.requestToken(ctx, payload)
+}
+
+// RefreshToken refreshes the SDK's access token now and returns it. For user
+// tokens the result carries the new refresh token, which replaces the old one.
+func (sdk *SDK) RefreshToken() (*AccessTokenObject, error) {
+	return sdk.RefreshTokenContext(context.Background())
+}
+
+// RefreshTokenContext is like RefreshToken but uses ctx for its requests.
+func (sdk *SDK) RefreshTokenContext(ctx context.Context) (*AccessTokenObject, error) {
+	if sdk.config == nil || sdk.tokens == nil {
+		return nil, errConfig
+	}
+	if ts, ok := sdk.tokens.(tokenInvalidator); ok {
+		return ts.refresh(ctx)
+	}
+	return sdk.tokens.Token(ctx)
+}
+
+// RevokeToken revokes the SDK's access token, and with it the refresh token
+// it was issued with.
+func (sdk *SDK) RevokeToken() error {
+	return sdk.RevokeTokenContext(context.Background())
+}
+
+// RevokeTokenContext is like RevokeToken but uses ctx for its requests.
+func (sdk *SDK) RevokeTokenContext(ctx context.Context) error {
+	if sdk.config == nil || sdk.tokens == nil {
+		return errConfig
+	}
+	token, err := sdk.tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload := url.Values{}
+	payload.Add("token", token.AccessToken)
+	payload.Add("client_id", sdk.config.BoxAppSettings.ClientID)
+	payload.Add("client_secret", sdk.config.BoxAppSettings.ClientSecret)
+
+	header := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	_, err = sdk.call(ctx, "POST", sdk.revokeURL(), bytes.NewBufferString(payload.Encode()), header, false)
+	if err != nil {
+		return err
+	}
+	if ts, ok := sdk.tokens.(tokenInvalidator); ok {
+		return ts.forget()
+	}
+	return nil
+}
+
+// NewClientCredentialsSDK returns an SDK that authenticates with the Client
+// Credentials Grant, using only the app's client ID and secret instead of a
+// key pair. Tokens are issued for the subject selected by cfg.SubjectType.
+func NewClientCredentialsSDK(cfg *Config) (*SDK, error) {
+	return NewClient(ClientCredentialsAuth(cfg))
+}
+
+// clientCredentialsToken requests a new access token using the Client
+// Credentials Grant.
+func (sdk *SDK) clientCredentialsToken(ctx context.Context, _ *AccessTokenObject) (*AccessTokenObject, error) {
+	subjectType, subjectID, err := sdk.config.subject()
+	if err != nil {
+		return nil, err
+	}
+	return sdk.clientCredentialsGrant(ctx, subjectType, subjectID)
+}
+
+// clientCredentialsGrant requests a new access token for the given subject
+// using the Client Credentials Grant.
+func (sdk *SDK) clientCredentialsGrant(ctx context.Context, subjectType SubjectType, subjectID string) (*AccessTokenObject, error) {
+	payload := url.Values{}
+	payload.Add("grant_type", "client_credentials")
+	payload.Add("client_id", sdk.config.BoxAppSettings.ClientID)
+	payload.Add("client_secret", sdk.config.BoxAppSettings.ClientSecret)
+	payload.Add("box_subject_type", string(subjectType))
+	payload.Add("box_subject_id", subjectID)
+	return sdk.requestToken(ctx, payload)
+}
+
+// revokeURL is the URL tokens are revoked at.
+func (sdk *SDK) revokeURL() string {
+	return baseURL(sdk.endpoints.OAuth, defaultOAuthURL) + "/revoke"
+}
+
+// FileResource returns the resource URL of a file, for use with ExchangeToken.
+func FileResource(fileID string) string {
+	return defaultAPIURL + "/files/" + fileID
+}
+
+// FolderResource returns the resource URL of a folder, for use with
+// ExchangeToken.
+func FolderResource(folderID string) string {
+	return defaultAPIURL + "/folders/" + folderID
+}
+
+// ExchangeToken exchanges the SDK's access token for a downscoped token that
+// only grants the given scopes, such as "item_preview" or "item_upload". An
+// optional resource, built with FileResource or FolderResource, restricts the
+// token to a single item. The SDK keeps using its own token.
+func (sdk *SDK) ExchangeToken(scopes []string, resource string) (*AccessTokenObject, error) {
+	return sdk.ExchangeTokenContext(context.Background(), scopes, resource)
+}
+
+// ExchangeTokenContext is like ExchangeToken but uses ctx for its requests.
+func (sdk *SDK) ExchangeTokenContext(ctx context.Context, scopes []string, resource string) (*AccessTokenObject, error) {
+	if sdk.config == nil || sdk.tokens == nil {
+		return nil, errConfig
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("box: token exchange needs at least one scope")
+	}
+	token, err := sdk.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := url.Values{}
+	payload.Add("grant_type", "urn:ietf:params:oauth:grant-type:token-exchange")
+	payload.Add("subject_token", token.AccessToken)
+	payload.Add("subject_token_type", "urn:ietf:params:oauth:token-type:access_token")
+	payload.Add("scope", strings.Join(scopes, " "))
+	if resource != "" {
+		payload.Add("resource", resource)
+	}
+	return sdk.requestToken(ctx, payload)
+}
@@ -0,0 +1,191 @@
+package box
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ghostofcookie/gobox/boxtest"
+)
+
+func TestAuthCodeURL(t *testing.T) {
+	sdk := new(SDK)
+	sdk.NewConfig(&Config{BoxAppSettings: AppSettings{ClientID: "client-id"}})
+	link, err := url.Parse(sdk.AuthCodeURL("http://localhost/callback", "xyz", "root_readwrite", "manage_groups"))
+	if err != nil {
+		t.Fatal("Expected a valid URL, got", err)
+	}
+	if link.Host != "account.box.com" || link.Path != "/api/oauth2/authorize" {
+		t.Error("Unexpected authorize endpoint", link)
+	}
+	query := link.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != "client-id" ||
+		query.Get("redirect_uri") != "http://localhost/callback" || query.Get("state") != "xyz" ||
+		query.Get("scope") != "root_readwrite manage_groups" {
+		t.Error("Unexpected authorize parameters", query)
+	}
+}
+
+func TestAuthorizationCode(t *testing.T) {
+	t.Run("TestExchangeCode", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		token, err := sdk.ExchangeCode(srv.AuthCode(), "")
+		if err != nil {
+			t.Fatal("Expected the code to be exchanged, got", err)
+		}
+		if token.AccessToken == "" || token.RefreshToken == "" {
+			t.Error("Expected an access and a refresh token")
+		}
+		if _, err := sdk.GetFolderInfo("0"); err != nil {
+			t.Error("Expected requests to use the user token, got", err)
+		}
+		if _, err := sdk.ExchangeCode("unknown", ""); err == nil {
+			t.Error("Expected an invalid code to be rejected")
+		}
+	})
+
+	t.Run("TestRefreshOnUnauthorized", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		first, _ := sdk.ExchangeCode(srv.AuthCode(), "")
+		srv.ExpireTokens()
+		if _, err := sdk.GetFolderInfo("0"); err != nil {
+			t.Fatal("Expected the token to be refreshed, got", err)
+		}
+		if _, err := sdk.refreshToken(context.Background(), first.RefreshToken); err == nil {
+			t.Error("Expected the old refresh token to have been rotated")
+		}
+	})
+
+	t.Run("TestRefreshToken", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		first, _ := sdk.ExchangeCode(srv.AuthCode(), "")
+		second, err := sdk.RefreshToken()
+		if err != nil {
+			t.Fatal("Expected the token to be refreshed, got", err)
+		}
+		if second.AccessToken == first.AccessToken || second.RefreshToken == first.RefreshToken {
+			t.Error("Expected new tokens")
+		}
+		third, _ := sdk.RefreshToken()
+		if third.RefreshToken == second.RefreshToken {
+			t.Error("Expected the rotated refresh token to be used")
+		}
+	})
+
+	t.Run("TestNoRefreshToken", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.SetToken(&AccessTokenObject{AccessToken: "stale", ExpiresIn: 60, Expiry: time.Now()})
+		if _, err := sdk.GetFolderInfo("0"); !errors.Is(err, errNoRefreshToken) {
+			t.Error("Expected a missing refresh token error, got", err)
+		}
+	})
+
+	t.Run("TestRevokeToken", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.ExchangeCode(srv.AuthCode(), "")
+		if err := sdk.RevokeToken(); err != nil {
+			t.Fatal("Expected the token to be revoked, got", err)
+		}
+		if _, err := sdk.GetFolderInfo("0"); err == nil {
+			t.Error("Expected requests to fail once the tokens are revoked")
+		}
+	})
+}
+
+func TestClientCredentials(t *testing.T) {
+	t.Run("TestEnterprise", func(t *testing.T) {
+		srv := boxtest.NewServer()
+		defer srv.Close()
+		srv.ClientID, srv.ClientSecret = "client-id", "client-secret"
+		sdk, err := NewClientCredentialsSDK(&Config{
+			BoxAppSettings: AppSettings{ClientID: "client-id", ClientSecret: "client-secret"},
+			EnterpriseID:   "enterprise-id",
+		})
+		if err != nil {
+			t.Fatal("Expected an SDK, got", err)
+		}
+		sdk.SetEndpoints(Endpoints{API: srv.APIURL(), OAuth: srv.OAuthURL()})
+
+		if _, err := sdk.GetFolderInfo("0"); err != nil {
+			t.Fatal("Expected to receive Folder info, got", err)
+		}
+		token, _ := sdk.tokens.Token(context.Background())
+		if got := srv.TokenSubject(token.AccessToken); got != "enterprise:enterprise-id" {
+			t.Error("Expected an enterprise token, got", got)
+		}
+	})
+
+	t.Run("TestUser", func(t *testing.T) {
+		srv := boxtest.NewServer()
+		defer srv.Close()
+		sdk, err := NewClientCredentialsSDK(&Config{
+			BoxAppSettings: AppSettings{ClientID: "client-id", ClientSecret: "client-secret"},
+			SubjectType:    SubjectUser,
+			UserID:         "42",
+		})
+		if err != nil {
+			t.Fatal("Expected an SDK, got", err)
+		}
+		sdk.SetEndpoints(Endpoints{API: srv.APIURL(), OAuth: srv.OAuthURL()})
+
+		if err := sdk.RequestAccessToken(); err != nil {
+			t.Fatal("Expected an access token, got", err)
+		}
+		token, _ := sdk.tokens.Token(context.Background())
+		if got := srv.TokenSubject(token.AccessToken); got != "user:42" {
+			t.Error("Expected a user token, got", got)
+		}
+	})
+
+	t.Run("TestInvalidConfig", func(t *testing.T) {
+		configs := []*Config{
+			{EnterpriseID: "enterprise-id"},
+			{BoxAppSettings: AppSettings{ClientID: "client-id", ClientSecret: "client-secret"}},
+			{BoxAppSettings: AppSettings{ClientID: "client-id", ClientSecret: "client-secret"}, SubjectType: SubjectUser},
+			{BoxAppSettings: AppSettings{ClientID: "client-id", ClientSecret: "client-secret"}, SubjectType: "group", UserID: "1"},
+		}
+		for _, cfg := range configs {
+			if _, err := NewClientCredentialsSDK(cfg); err == nil {
+				t.Errorf("Expected %+v to be rejected", cfg)
+			}
+		}
+	})
+}
+
+func TestExchangeToken(t *testing.T) {
+	sdk, srv := setup()
+	defer srv.Close()
+	id := srv.AddFile(boxtest.RootID, "a.txt", []byte("a"))
+
+	token, err := sdk.ExchangeToken([]string{"item_preview", "item_upload"}, FileResource(id))
+	if err != nil {
+		t.Fatal("Expected a downscoped token, got", err)
+	}
+	if token.AccessToken == "" || token.Expiry.IsZero() ||
+		token.IssuedTokenType != "urn:ietf:params:oauth:token-type:access_token" {
+		t.Errorf("Unexpected token %+v", token)
+	}
+	if len(token.RestrictedTo) != 2 || token.RestrictedTo[0].Scope != "item_preview" ||
+		token.RestrictedTo[0].Object == nil || token.RestrictedTo[0].Object.ID != id {
+		t.Errorf("Expected the token to be restricted to file %s, got %+v", id, token.RestrictedTo)
+	}
+
+	current, _ := sdk.tokens.Token(context.Background())
+	if current.AccessToken == token.AccessToken {
+		t.Error("Expected the SDK to keep its own token")
+	}
+
+	if _, err := sdk.ExchangeToken(nil, ""); err == nil {
+		t.Error("Expected an exchange without scopes to be rejected")
+	}
+	if _, err := sdk.ExchangeToken([]string{"item_preview"}, FolderResource(id)); err == nil {
+		t.Error("Expected an invalid resource to be rejected")
+	}
+}
@@ -2,24 +2,26 @@ package box
 
 // Item is the base structure of a Box object.
 type Item struct {
-	Type           string          `json:"type"`
-	ID             string          `json:"id"`
-	FileVersion    *FileVersion    `json:"file_version,omitempty"`
-	SequenceID     string          `json:"sequence_id,omitempty"`
-	Etag           string          `json:"etag,omitempty"`
-	Sha1           string          `json:"sha1,omitempty"`
-	Name           string          `json:"name"`
-	Description    string          `json:"description,omitempty"`
-	Size           int             `json:"size"`
-	PathCollection *PathCollection `json:"path_collection,omitempty"`
-	CreatedAt      string          `json:"created_at,omitempty"`
-	ModifiedAt     string          `json:"modified_at,omitempty"`
-	CreatedBy      *User           `json:"created_by,omitempty"`
-	ModifiedBy     *User           `json:"modified_by,omitempty"`
-	OwnedBy        *User           `json:"owned_by,omitempty"`
-	SharedLink     *SharedLink     `json:"shared_link,omitempty"`
-	Parent         *Parent         `json:"parent,omitempty"`
-	ItemStatus     string          `json:"item_status,omitempty"`
+	Type              string          `json:"type"`
+	ID                string          `json:"id"`
+	FileVersion       *FileVersion    `json:"file_version,omitempty"`
+	SequenceID        string          `json:"sequence_id,omitempty"`
+	Etag              string          `json:"etag,omitempty"`
+	Sha1              string          `json:"sha1,omitempty"`
+	Name              string          `json:"name"`
+	Description       string          `json:"description,omitempty"`
+	Size              int             `json:"size"`
+	PathCollection    *PathCollection `json:"path_collection,omitempty"`
+	CreatedAt         string          `json:"created_at,omitempty"`
+	ModifiedAt        string          `json:"modified_at,omitempty"`
+	ContentCreatedAt  string          `json:"content_created_at,omitempty"`
+	ContentModifiedAt string          `json:"content_modified_at,omitempty"`
+	CreatedBy         *User           `json:"created_by,omitempty"`
+	ModifiedBy        *User           `json:"modified_by,omitempty"`
+	OwnedBy           *User           `json:"owned_by,omitempty"`
+	SharedLink        *SharedLink     `json:"shared_link,omitempty"`
+	Parent            *Parent         `json:"parent,omitempty"`
+	ItemStatus        string          `json:"item_status,omitempty"`
 }
 
 // FileObject : File information describe file objects in Box, with attributes
@@ -29,13 +31,31 @@ type Item struct {
 // default and must be retrieved through the fields parameter.
 type FileObject struct {
 	Item
+	Tags          []string `json:"tags,omitempty"`
+	Lock          *Lock    `json:"lock,omitempty"`
+	DispositionAt string   `json:"disposition_at,omitempty"`
+}
+
+// Lock : A lock on a file, preventing others from changing it.
+type Lock struct {
+	Type                string `json:"type,omitempty"`
+	ID                  string `json:"id,omitempty"`
+	CreatedBy           *User  `json:"created_by,omitempty"`
+	CreatedAt           string `json:"created_at,omitempty"`
+	ExpiresAt           string `json:"expires_at,omitempty"`
+	IsDownloadPrevented bool   `json:"is_download_prevented,omitempty"`
 }
 
 // FolderObject : A Box Folder object.
 type FolderObject struct {
 	Item
-	ItemCollection *ItemCollection `json:"item_collection,omitempty"`
-	Tags           []string        `json:"tags,omitempty"`
+	ItemCollection    *ItemCollection    `json:"item_collection,omitempty"`
+	Tags              []string           `json:"tags,omitempty"`
+	FolderUploadEmail *FolderUploadEmail `json:"folder_upload_email,omitempty"`
+	SyncState         string             `json:"sync_state,omitempty"`
+
+	CanNonOwnersInvite                    bool `json:"can_non_owners_invite,omitempty"`
+	IsCollaborationRestrictedToEnterprise bool `json:"is_collaboration_restricted_to_enterprise,omitempty"`
 }
 
 // FileVersion : Contains version information of a FileObject.
@@ -49,14 +69,25 @@ type FileVersion struct {
 	ModifiedAt string `json:"modified_at,omitempty"`
 	ModifiedBy *User  `json:"modified_by,omitempty"`
 	TrashedAt  string `json:"trashed_at,omitempty"`
+	TrashedBy  *User  `json:"trashed_by,omitempty"`
+	RestoredAt string `json:"restored_at,omitempty"`
+	RestoredBy *User  `json:"restored_by,omitempty"`
 	PurgedAt   string `json:"purged_at,omitempty"`
 }
 
+// FileVersionList : A page of the previous versions of a file, newest first.
+type FileVersionList struct {
+	TotalCount int            `json:"total_count"`
+	Entries    []*FileVersion `json:"entries"`
+	Offset     int            `json:"offset"`
+	Limit      int            `json:"limit"`
+}
+
 // Entries : A more in-depth response containing more information about box objects.
 type Entries struct {
 	Type              string          `json:"type,omitempty"`
 	ID                string          `json:"id,omitempty"`
-	SequenceID        struct{}        `json:"sequence_id,omitempty"`
+	SequenceID        string          `json:"sequence_id,omitempty"`
 	Etag              string          `json:"etag,omitempty"`
 	Name              string          `json:"name,omitempty"`
 	Sha1              string          `json:"sha1,omitempty"`
@@ -65,8 +96,8 @@ type Entries struct {
 	PathCollection    *PathCollection `json:"path_collection,omitempty"`
 	CreatedAt         string          `json:"created_at,omitempty"`
 	ModifiedAt        string          `json:"modified_at,omitempty"`
-	TrashedAt         struct{}        `json:"trashed_at,omitempty"`
-	PurgedAt          struct{}        `json:"purged_at,omitempty"`
+	TrashedAt         string          `json:"trashed_at,omitempty"`
+	PurgedAt          string          `json:"purged_at,omitempty"`
 	ContentCreatedAt  string          `json:"content_created_at,omitempty"`
 	ContentModifiedAt string          `json:"content_modified_at,omitempty"`
 	CreatedBy         *User           `json:"created_by,omitempty"`
@@ -83,6 +114,22 @@ type PathCollection struct {
 	Entries    []*Entries `json:"entries,omitempty"`
 }
 
+// Part : A part of a file uploaded to a chunked upload session.
+type Part struct {
+	PartID string `json:"part_id"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Sha1   string `json:"sha1,omitempty"`
+}
+
+// PartList : A page of the parts uploaded to a chunked upload session.
+type PartList struct {
+	TotalCount int    `json:"total_count"`
+	Entries    []Part `json:"entries"`
+	Offset     int    `json:"offset"`
+	Limit      int    `json:"limit"`
+}
+
 // User : Contains information about a Box user.
 type User struct {
 	Type  string `json:"type,omitempty"`
@@ -110,10 +157,10 @@ type Permissions struct {
 // SharedLink : A shared link to a downloadable file.
 type SharedLink struct {
 	URL               string       `json:"url,omitempty"`
-	DownloadURL       struct{}     `json:"download_url,omitempty"`
-	VanityURL         struct{}     `json:"vanity_url,omitempty"`
+	DownloadURL       string       `json:"download_url,omitempty"`
+	VanityURL         string       `json:"vanity_url,omitempty"`
 	IsPasswordEnabled bool         `json:"is_password_enabled,omitempty"`
-	UnsharedAt        struct{}     `json:"unshared_at,omitempty"`
+	UnsharedAt        string       `json:"unshared_at,omitempty"`
 	DownloadCount     int          `json:"download_count,omitempty"`
 	PreviewCount      int          `json:"preview_count,omitempty"`
 	Access            string       `json:"access,omitempty"`
@@ -128,11 +175,11 @@ type FolderUploadEmail struct {
 
 // Parent : Parent folder of a returned box object.
 type Parent struct {
-	Type       string   `json:"type,omitempty"`
-	ID         string   `json:"id,omitempty"`
-	SequenceID struct{} `json:"sequence_id,omitempty"`
-	Etag       struct{} `json:"etag,omitempty"`
-	Name       string   `json:"name,omitempty"`
+	Type       string `json:"type,omitempty"`
+	ID         string `json:"id,omitempty"`
+	SequenceID string `json:"sequence_id,omitempty"`
+	Etag       string `json:"etag,omitempty"`
+	Name       string `json:"name,omitempty"`
 }
 
 // ItemCollection : Total count up to the limit of the number of entries in a folder, as well as the entries themselves.
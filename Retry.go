@@ -0,0 +1,186 @@
+package box
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultBaseDelay = 500 * time.Millisecond
+	defaultMaxDelay  = 30 * time.Second
+)
+
+// RetryPolicy controls how requests that fail with a 429, a 5xx status or a
+// network error are retried. The zero value disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every
+	// further attempt, with jitter. Defaults to 500ms.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between attempts. Defaults to 30s. A
+	// Retry-After header sent by Box is always honored.
+	MaxDelay time.Duration
+	// RetryNonIdempotent allows POST requests to be retried after a 5xx or a
+	// network error, when the request may already have been processed. A 429
+	// is always retried since Box has not acted on the request.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy is a reasonable policy for most applications.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   defaultBaseDelay,
+	MaxDelay:    defaultMaxDelay,
+}
+
+// SetRetryPolicy sets the policy used to retry failed requests.
+func (sdk *SDK) SetRetryPolicy(policy RetryPolicy) {
+	sdk.retry = policy
+}
+
+// idempotent reports whether a request with the given method can be sent
+// again without side effects.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryDelay reports whether a request that failed with err on the given
+// attempt should be retried, and how long to wait first.
+func (p RetryPolicy) retryDelay(method string, attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+		case apiErr.StatusCode >= http.StatusInternalServerError &&
+			(idempotent(method) || p.RetryNonIdempotent):
+		default:
+			return 0, false
+		}
+		if apiErr.RetryAfter > 0 {
+			return apiErr.RetryAfter, true
+		}
+	} else if !idempotent(method) && !p.RetryNonIdempotent {
+		return 0, false
+	}
+	return p.backoff(attempt), true
+}
+
+// backoff returns an exponential delay with jitter for the given attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	base, max := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = defaultBaseDelay
+	}
+	if max <= 0 {
+		max = defaultMaxDelay
+	}
+
+	delay := base << uint(attempt-1)
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// errNotReplayable is returned when a request body cannot be produced for
+// another attempt.
+var errNotReplayable = errors.New("box: request body cannot be sent again")
+
+// bodySource is a request body produced afresh by open for every attempt,
+// such as a streamed multipart upload. It is never buffered; open returns
+// errNotReplayable once the body cannot be produced again.
+type bodySource struct {
+	open func() (io.Reader, error)
+}
+
+func (b *bodySource) Read(p []byte) (int, error) {
+	return 0, errors.New("box: reading an unopened request body")
+}
+
+// sizedBody is a rewound request body of a known size. It hides any Close
+// method so the transport can't close the source, and carries the size the
+// transport can no longer see so the request keeps its Content-Length.
+type sizedBody struct {
+	io.Reader
+	size int64
+}
+
+// replayBody returns a function producing the request body for each attempt.
+// In-memory bodies are reused and seekable bodies are rewound. Any other
+// reader is buffered only when buffer is set, as it can otherwise be sent
+// once and later attempts fail with errNotReplayable.
+func replayBody(body io.Reader, buffer bool) (func() (io.Reader, error), error) {
+	if b, ok := body.(*bodySource); ok {
+		return b.open, nil
+	}
+	if body == nil {
+		return func() (io.Reader, error) { return nil, nil }, nil
+	}
+
+	switch b := body.(type) {
+	case *bytes.Buffer:
+		data := b.Bytes()
+		return func() (io.Reader, error) { return bytes.NewReader(data), nil }, nil
+	case io.ReadSeeker:
+		start, err := b.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("box: preparing request body: %w", err)
+		}
+		end, err := b.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, fmt.Errorf("box: preparing request body: %w", err)
+		}
+		return func() (io.Reader, error) {
+			if _, err := b.Seek(start, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("box: rewinding request body: %w", err)
+			}
+			return &sizedBody{Reader: b, size: end - start}, nil
+		}, nil
+	}
+
+	if !buffer {
+		sent := false
+		return func() (io.Reader, error) {
+			if sent {
+				return nil, errNotReplayable
+			}
+			sent = true
+			return body, nil
+		}, nil
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("box: buffering request body: %w", err)
+	}
+	return func() (io.Reader, error) { return bytes.NewReader(data), nil }, nil
+}
@@ -0,0 +1,206 @@
+package box
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghostofcookie/gobox/boxtest"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("TestServerError", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.RequestAccessToken()
+		sdk.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+		srv.FailNext(2, http.StatusServiceUnavailable, 0)
+
+		if _, err := sdk.GetFolderInfo("0"); err != nil {
+			t.Error("Expected the request to succeed after retrying, got", err)
+		}
+		if got := srv.Requests(); got != 4 {
+			t.Errorf("Expected 3 attempts after the token request, got %d", got-1)
+		}
+	})
+
+	t.Run("TestGiveUp", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.RequestAccessToken()
+		sdk.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})
+		srv.FailNext(2, http.StatusBadGateway, 0)
+
+		if _, err := sdk.GetFolderInfo("0"); !hasStatus(err, http.StatusBadGateway) {
+			t.Error("Expected the last 502 to be returned, got", err)
+		}
+	})
+
+	t.Run("TestNoRetryByDefault", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.RequestAccessToken()
+		srv.FailNext(1, http.StatusServiceUnavailable, 0)
+
+		if _, err := sdk.GetFolderInfo("0"); err == nil {
+			t.Error("Expected the 503 to be returned")
+		}
+	})
+
+	t.Run("TestNonIdempotent", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.RequestAccessToken()
+		sdk.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+		srv.FailNext(1, http.StatusServiceUnavailable, 0)
+
+		if _, err := sdk.CreateFolder("docs", "0"); err == nil {
+			t.Error("Expected a POST not to be retried after a 503")
+		}
+		if got := srv.Requests(); got != 2 {
+			t.Errorf("Expected 1 attempt after the token request, got %d", got-1)
+		}
+	})
+
+	t.Run("TestRateLimitedUpload", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.RequestAccessToken()
+		sdk.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+		srv.FailNext(1, http.StatusTooManyRequests, 1)
+
+		start := time.Now()
+		collection, err := sdk.UploadFile([]byte("hello"), "hello.txt", "0")
+		if err != nil {
+			t.Fatal("Expected the upload to be retried, got", err)
+		}
+		if time.Since(start) < time.Second {
+			t.Error("Expected Retry-After to be honored")
+		}
+		if got, _ := srv.Content(collection.Entries[0].ID); string(got) != "hello" {
+			t.Errorf("Expected the body to be replayed, got %q", got)
+		}
+	})
+}
+
+func TestContentLength(t *testing.T) {
+	policies := map[string]RetryPolicy{
+		"TestNoRetry": {},
+		"TestRetry":   {MaxAttempts: 2, BaseDelay: time.Millisecond},
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			sdk, srv := setup()
+			defer srv.Close()
+			sdk.RequestAccessToken()
+			sdk.SetRetryPolicy(policy)
+			fileID := srv.AddFile(boxtest.RootID, "a.txt", []byte("a"))
+
+			if _, err := sdk.CreateFolder("docs", boxtest.RootID); err != nil {
+				t.Fatal("Expected to create a folder, got", err)
+			}
+			if got := srv.LastContentLength(); got <= 0 {
+				t.Error("Expected the POST to have a Content-Length, got", got)
+			}
+
+			if _, err := sdk.PreflightCheck("b.txt", boxtest.RootID, 1); err != nil {
+				t.Fatal("Expected a preflight result, got", err)
+			}
+			if got := srv.LastContentLength(); got <= 0 {
+				t.Error("Expected the OPTIONS to have a Content-Length, got", got)
+			}
+
+			if policy.MaxAttempts > 1 {
+				srv.FailNext(1, http.StatusServiceUnavailable, 0)
+			}
+			if _, err := sdk.UpdateFile(fileID, &FileUpdate{Name: "c.txt"}, ""); err != nil {
+				t.Fatal("Expected to update the file, got", err)
+			}
+			if got := srv.LastContentLength(); got <= 0 {
+				t.Error("Expected the PUT to have a Content-Length, got", got)
+			}
+		})
+	}
+}
+
+func TestReplayBody(t *testing.T) {
+	t.Run("TestStreamNotBuffered", func(t *testing.T) {
+		body := ioutil.NopCloser(strings.NewReader("data"))
+		next, err := replayBody(body, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, err := next(); err != nil || r != body {
+			t.Error("Expected the stream to be sent as given, got", r, err)
+		}
+		if _, err := next(); err != errNotReplayable {
+			t.Error("Expected the stream not to be sent again, got", err)
+		}
+	})
+
+	t.Run("TestStreamBuffered", func(t *testing.T) {
+		next, err := replayBody(ioutil.NopCloser(strings.NewReader("data")), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for attempt := 1; attempt <= 2; attempt++ {
+			r, err := next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := ioutil.ReadAll(r); string(data) != "data" {
+				t.Errorf("Expected attempt %d to send the body, got %q", attempt, data)
+			}
+		}
+	})
+
+	t.Run("TestSeekerRewound", func(t *testing.T) {
+		body := strings.NewReader("skip data")
+		body.Seek(5, io.SeekStart)
+		next, err := replayBody(body, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for attempt := 1; attempt <= 2; attempt++ {
+			r, err := next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := r.(*sizedBody).size; size != 4 {
+				t.Errorf("Expected attempt %d to have 4 bytes, got %d", attempt, size)
+			}
+			if data, _ := ioutil.ReadAll(r); string(data) != "data" {
+				t.Errorf("Expected attempt %d to send the body, got %q", attempt, data)
+			}
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	if got := retryAfter("3"); got != 3*time.Second {
+		t.Error("Expected 3s, got", got)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := retryAfter(date); got <= 0 || got > time.Minute {
+		t.Error("Expected up to a minute, got", got)
+	}
+	if got := retryAfter("soon"); got != 0 {
+		t.Error("Expected no delay, got", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, max := range []time.Duration{0, 100, 200, 400, 800, 1000, 1000} {
+		if attempt == 0 {
+			continue
+		}
+		max *= time.Millisecond
+		if got := policy.backoff(attempt); got < max/2 || got > max {
+			t.Errorf("Attempt %d: expected a delay in [%s, %s], got %s", attempt, max/2, max, got)
+		}
+	}
+}
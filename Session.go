@@ -0,0 +1,499 @@
+package box
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Session is a chunked upload session, used to upload files too large for
+// UploadFile in parts. Create one with SDK.NewSession and start it with
+// NewFile or NewVersion, or continue one with SDK.ResumeSession. Parts may be
+// uploaded concurrently.
+type Session struct {
+	sdk *SDK
+
+	ID                string `json:"id"`
+	FileSize          int64  `json:"file_size"`
+	PartSize          int64  `json:"part_size"`
+	TotalParts        int    `json:"total_parts"`
+	NumPartsProcessed int    `json:"num_parts_processed"`
+	ExpiresAt         string `json:"session_expires_at"`
+
+	// IfMatch, when set for a new version, makes the commit fail with a 412
+	// Precondition Failed error if the file's etag no longer matches.
+	IfMatch string `json:"-"`
+
+	// ContentModifiedAt, when set, is committed as the time the file's
+	// content was last modified.
+	ContentModifiedAt time.Time `json:"-"`
+
+	// Concurrency is the number of parts Upload sends at once. It defaults
+	// to the SDK's upload concurrency, or 1.
+	Concurrency int `json:"-"`
+
+	// Checkpoint, when set, is called with the session's state after every
+	// uploaded part, so it can be saved and the upload resumed after a
+	// crash. Calls are serialized.
+	Checkpoint func(state *SessionState) `json:"-"`
+
+	mu           sync.Mutex
+	parts        []Part
+	checkpointMu sync.Mutex
+}
+
+// SessionState is the serializable state of an upload session.
+type SessionState struct {
+	ID         string `json:"id"`
+	FileSize   int64  `json:"file_size"`
+	PartSize   int64  `json:"part_size"`
+	TotalParts int    `json:"total_parts"`
+	ExpiresAt  string `json:"session_expires_at,omitempty"`
+	Parts      []Part `json:"parts"`
+
+	IfMatch           string    `json:"if_match,omitempty"`
+	ContentModifiedAt time.Time `json:"content_modified_at"`
+}
+
+// fileCollection is the list of files returned by uploads.
+type fileCollection struct {
+	TotalCount int           `json:"total_count"`
+	Entries    []*FileObject `json:"entries"`
+}
+
+// SetUploadConcurrency sets the number of parts sessions upload at once.
+func (sdk *SDK) SetUploadConcurrency(n int) {
+	sdk.uploadWorkers = n
+}
+
+// NewSession returns an upload session that is not started yet.
+func (sdk *SDK) NewSession() *Session {
+	return &Session{sdk: sdk, Concurrency: sdk.uploadWorkers}
+}
+
+// ResumeSession continues an upload session from its saved state. The parts
+// Box has received are listed again, so parts uploaded after the state was
+// saved are not sent twice.
+func (sdk *SDK) ResumeSession(state *SessionState) (*Session, error) {
+	return sdk.ResumeSessionContext(context.Background(), state)
+}
+
+// ResumeSessionContext is like ResumeSession but uses ctx for its requests.
+func (sdk *SDK) ResumeSessionContext(ctx context.Context, state *SessionState) (*Session, error) {
+	s := sdk.NewSession()
+	s.ID = state.ID
+	s.FileSize = state.FileSize
+	s.PartSize = state.PartSize
+	s.TotalParts = state.TotalParts
+	s.ExpiresAt = state.ExpiresAt
+	s.IfMatch = state.IfMatch
+	s.ContentModifiedAt = state.ContentModifiedAt
+	for _, part := range state.Parts {
+		s.addPart(part)
+	}
+
+	for offset := 0; ; {
+		list, err := s.ListPartsContext(ctx, offset, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range list.Entries {
+			s.addPart(part)
+		}
+		offset += len(list.Entries)
+		if len(list.Entries) == 0 || offset >= list.TotalCount {
+			break
+		}
+	}
+	return s, nil
+}
+
+// State returns the session's state, to be saved for ResumeSession.
+func (s *Session) State() *SessionState {
+	return &SessionState{
+		ID:         s.ID,
+		FileSize:   s.FileSize,
+		PartSize:   s.PartSize,
+		TotalParts: s.TotalParts,
+		ExpiresAt:  s.ExpiresAt,
+		Parts:      s.Parts(),
+
+		IfMatch:           s.IfMatch,
+		ContentModifiedAt: s.ContentModifiedAt,
+	}
+}
+
+// sessionURL is the base URL of the upload sessions API.
+func (sdk *SDK) sessionURL() string {
+	return baseURL(sdk.endpoints.Upload, defaultUploadURL) + "/files/upload_sessions"
+}
+
+// digest returns the Digest header value for a SHA1 sum.
+func digest(sum []byte) string {
+	return "sha=" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// NewFile starts the session for a new file of fileSize bytes called
+// fileName in the folder with ID folderID.
+func (s *Session) NewFile(folderID string, fileSize int64, fileName string) error {
+	return s.NewFileContext(context.Background(), folderID, fileSize, fileName)
+}
+
+// NewFileContext is like NewFile but uses ctx for its requests.
+func (s *Session) NewFileContext(ctx context.Context, folderID string, fileSize int64, fileName string) error {
+	body := map[string]interface{}{
+		"folder_id": folderID,
+		"file_size": fileSize,
+		"file_name": fileName,
+	}
+	return s.create(ctx, s.sdk.sessionURL(), fileSize, body)
+}
+
+// NewVersion starts the session for a new version, of fileSize bytes, of the
+// file with ID fileID. If fileName is set the file is also renamed.
+func (s *Session) NewVersion(fileID string, fileSize int64, fileName string) error {
+	return s.NewVersionContext(context.Background(), fileID, fileSize, fileName)
+}
+
+// NewVersionContext is like NewVersion but uses ctx for its requests.
+func (s *Session) NewVersionContext(ctx context.Context, fileID string, fileSize int64, fileName string) error {
+	body := map[string]interface{}{"file_size": fileSize}
+	if fileName != "" {
+		body["file_name"] = fileName
+	}
+	url := baseURL(s.sdk.endpoints.Upload, defaultUploadURL) + "/files/" + fileID + "/upload_sessions"
+	return s.create(ctx, url, fileSize, body)
+}
+
+// create starts the session for a file of fileSize bytes.
+func (s *Session) create(ctx context.Context, url string, fileSize int64, body map[string]interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("box: encoding upload session: %w", err)
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	response, err := s.sdk.request(ctx, "POST", url, bytes.NewReader(payload), headers)
+	if err != nil {
+		return err
+	}
+	if err := unmarshal(response, s); err != nil {
+		return err
+	}
+	s.FileSize = fileSize
+	s.mu.Lock()
+	s.parts = nil
+	s.mu.Unlock()
+	return nil
+}
+
+// UploadPart uploads the part of the file starting at offset. Every part
+// except the last must be exactly PartSize bytes long.
+func (s *Session) UploadPart(data []byte, offset int64) (*Part, error) {
+	return s.UploadPartContext(context.Background(), data, offset)
+}
+
+// UploadPartContext is like UploadPart but uses ctx for its requests.
+func (s *Session) UploadPartContext(ctx context.Context, data []byte, offset int64) (*Part, error) {
+	if s.ID == "" {
+		return nil, errors.New("box: upload session is not started")
+	}
+	if len(data) == 0 {
+		return nil, errors.New("box: empty upload part")
+	}
+
+	sum := sha1.Sum(data)
+	headers := map[string]string{
+		"Content-Type":  "application/octet-stream",
+		"Content-Range": "bytes " + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(offset+int64(len(data))-1, 10) + "/" + strconv.FormatInt(s.FileSize, 10),
+		"Digest":        digest(sum[:]),
+	}
+	response, err := s.sdk.request(ctx, "PUT", s.sdk.sessionURL()+"/"+s.ID, bytes.NewReader(data), headers)
+	if err != nil {
+		return nil, err
+	}
+	uploaded := &struct {
+		Part Part `json:"part"`
+	}{}
+	if err := unmarshal(response, uploaded); err != nil {
+		return nil, err
+	}
+	s.addPart(uploaded.Part)
+
+	if s.Checkpoint != nil {
+		s.checkpointMu.Lock()
+		s.Checkpoint(s.State())
+		s.checkpointMu.Unlock()
+	}
+	return &uploaded.Part, nil
+}
+
+// addPart records an uploaded part, keeping the parts in file order.
+func (s *Session) addPart(part Part) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := sort.Search(len(s.parts), func(i int) bool { return s.parts[i].Offset >= part.Offset })
+	if i < len(s.parts) && s.parts[i].Offset == part.Offset {
+		s.parts[i] = part
+		return
+	}
+	s.parts = append(s.parts, Part{})
+	copy(s.parts[i+1:], s.parts[i:])
+	s.parts[i] = part
+}
+
+// Parts returns the parts uploaded through the session, in file order.
+func (s *Session) Parts() []Part {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Part(nil), s.parts...)
+}
+
+// uploaded reports whether the part at offset was already uploaded with the
+// given content.
+func (s *Session) uploaded(offset int64, data []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := sort.Search(len(s.parts), func(i int) bool { return s.parts[i].Offset >= offset })
+	if i == len(s.parts) || s.parts[i].Offset != offset || s.parts[i].Size != int64(len(data)) {
+		return false
+	}
+	sum := sha1.Sum(data)
+	return s.parts[i].Sha1 == hex.EncodeToString(sum[:])
+}
+
+// ListParts lists the parts Box has received for the session.
+func (s *Session) ListParts(offset int, limit int) (*PartList, error) {
+	return s.ListPartsContext(context.Background(), offset, limit)
+}
+
+// ListPartsContext is like ListParts but uses ctx for its requests.
+func (s *Session) ListPartsContext(ctx context.Context, offset int, limit int) (*PartList, error) {
+	opts := "?offset=" + strconv.Itoa(offset) + "&limit=" + strconv.Itoa(limit)
+	response, err := s.sdk.request(ctx, "GET", s.sdk.sessionURL()+"/"+s.ID+"/parts"+opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	partList := &PartList{}
+	if err := unmarshal(response, partList); err != nil {
+		return nil, err
+	}
+	return partList, nil
+}
+
+// CommitUpload assembles the uploaded parts into the file. fileSHA1 is the
+// hex-encoded SHA1 of the whole file. Commits Box is still processing are
+// retried until they complete.
+func (s *Session) CommitUpload(fileSHA1 string) (*FileObject, error) {
+	return s.CommitUploadContext(context.Background(), fileSHA1)
+}
+
+// CommitUploadContext is like CommitUpload but uses ctx for its requests.
+func (s *Session) CommitUploadContext(ctx context.Context, fileSHA1 string) (*FileObject, error) {
+	sum, err := hex.DecodeString(fileSHA1)
+	if err != nil || len(sum) != sha1.Size {
+		return nil, fmt.Errorf("box: invalid SHA1 %q", fileSHA1)
+	}
+	commit := map[string]interface{}{"parts": s.Parts()}
+	if !s.ContentModifiedAt.IsZero() {
+		commit["attributes"] = map[string]string{
+			"content_modified_at": s.ContentModifiedAt.Format(time.RFC3339),
+		}
+	}
+	payload, err := json.Marshal(commit)
+	if err != nil {
+		return nil, fmt.Errorf("box: encoding commit: %w", err)
+	}
+	headers := map[string]string{
+		"Content-Type": "application/json",
+		"Digest":       digest(sum),
+	}
+	if s.IfMatch != "" {
+		headers["If-Match"] = s.IfMatch
+	}
+
+	url := s.sdk.sessionURL() + "/" + s.ID + "/commit"
+	for attempt := 1; ; attempt++ {
+		response, err := s.sdk.do(ctx, "POST", url, bytes.NewReader(payload), headers, true)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("box: reading response from %s: %w", url, err)
+		}
+
+		if response.StatusCode != http.StatusAccepted {
+			files := &fileCollection{}
+			if err := unmarshal(body, files); err != nil {
+				return nil, err
+			}
+			if len(files.Entries) == 0 {
+				return nil, errors.New("box: commit returned no file")
+			}
+			return files.Entries[0], nil
+		}
+
+		// Box is still processing the parts.
+		delay := retryAfter(response.Header.Get("Retry-After"))
+		if delay <= 0 {
+			delay = s.sdk.retry.backoff(attempt)
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Abort cancels the session and discards the uploaded parts.
+func (s *Session) Abort() error {
+	return s.AbortContext(context.Background())
+}
+
+// AbortContext is like Abort but uses ctx for its requests.
+func (s *Session) AbortContext(ctx context.Context) error {
+	_, err := s.sdk.request(ctx, "DELETE", s.sdk.sessionURL()+"/"+s.ID, nil, nil)
+	return err
+}
+
+// Upload reads the file from r and uploads it part by part, Concurrency
+// parts at a time, then commits the session. r must yield exactly FileSize
+// bytes from the start of the file. Parts the session already holds with
+// the same content are skipped, so a resumed session only sends the rest.
+func (s *Session) Upload(r io.Reader) (*FileObject, error) {
+	return s.UploadContext(context.Background(), r)
+}
+
+// UploadContext is like Upload but uses ctx for its requests.
+func (s *Session) UploadContext(ctx context.Context, r io.Reader) (*FileObject, error) {
+	if s.ID == "" || s.PartSize <= 0 {
+		return nil, errors.New("box: upload session is not started")
+	}
+	workers := s.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	type job struct {
+		data   []byte
+		offset int64
+	}
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan job)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var uploadErr error
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if _, err := s.UploadPartContext(uploadCtx, j.data, j.offset); err != nil {
+					once.Do(func() {
+						uploadErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	// Read the file in order to hash it whole, handing parts to the workers.
+	hash := sha1.New()
+	var readErr error
+read:
+	for offset := int64(0); offset < s.FileSize; {
+		size := s.PartSize
+		if rest := s.FileSize - offset; rest < size {
+			size = rest
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			readErr = fmt.Errorf("box: reading upload: %w", err)
+			break
+		}
+		hash.Write(data)
+		if !s.uploaded(offset, data) {
+			select {
+			case jobs <- job{data, offset}:
+			case <-uploadCtx.Done():
+				break read
+			}
+		}
+		offset += size
+	}
+	close(jobs)
+	wg.Wait()
+
+	switch {
+	case uploadErr != nil:
+		return nil, uploadErr
+	case readErr != nil:
+		return nil, readErr
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	}
+	return s.CommitUploadContext(ctx, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// ChunkedUpload uploads a file of size bytes read from r to the folder with
+// ID folderID, using an upload session. The session is aborted if the upload
+// fails.
+func (sdk *SDK) ChunkedUpload(r io.Reader, size int64, fileName, folderID string) (*FileObject, error) {
+	return sdk.ChunkedUploadContext(context.Background(), r, size, fileName, folderID)
+}
+
+// ChunkedUploadContext is like ChunkedUpload but uses ctx for its requests.
+func (sdk *SDK) ChunkedUploadContext(ctx context.Context, r io.Reader, size int64, fileName, folderID string) (*FileObject, error) {
+	s := sdk.NewSession()
+	if err := s.NewFileContext(ctx, folderID, size, fileName); err != nil {
+		return nil, err
+	}
+	fileObject, err := s.UploadContext(ctx, r)
+	if err != nil {
+		s.AbortContext(context.Background())
+		return nil, err
+	}
+	return fileObject, nil
+}
+
+// ChunkedUploadFile uploads the file at path as ChunkedUpload does. If
+// fileName is empty the file keeps its local name.
+func (sdk *SDK) ChunkedUploadFile(path, fileName, folderID string) (*FileObject, error) {
+	return sdk.ChunkedUploadFileContext(context.Background(), path, fileName, folderID)
+}
+
+// ChunkedUploadFileContext is like ChunkedUploadFile but uses ctx for its
+// requests.
+func (sdk *SDK) ChunkedUploadFileContext(ctx context.Context, path, fileName, folderID string) (*FileObject, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("box: opening upload: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("box: opening upload: %w", err)
+	}
+	if fileName == "" {
+		fileName = filepath.Base(path)
+	}
+	return sdk.ChunkedUploadContext(ctx, file, info.Size(), fileName, folderID)
+}
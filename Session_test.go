@@ -0,0 +1,278 @@
+package box
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghostofcookie/gobox/boxtest"
+)
+
+// sessionContent is uploaded in parts of 16 bytes, the last one short.
+var sessionContent = bytes.Repeat([]byte("0123456789abcdef"), 4)[:60]
+
+// sessionSetup returns an SDK and fake server whose upload sessions use
+// parts of 16 bytes, with failed requests retried.
+func sessionSetup() (*SDK, *boxtest.Server) {
+	sdk, srv := setup()
+	srv.PartSize = 16
+	sdk.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	return sdk, srv
+}
+
+func TestSession(t *testing.T) {
+	t.Run("TestPartByPart", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+
+		s := sdk.NewSession()
+		if err := s.NewFile(boxtest.RootID, int64(len(sessionContent)), "big.bin"); err != nil {
+			t.Fatal("Expected the session to start, got", err)
+		}
+		if s.ID == "" || s.PartSize != 16 || s.TotalParts != 4 {
+			t.Fatal("Expected the session details, got", s)
+		}
+
+		for offset := int64(0); offset < s.FileSize; offset += s.PartSize {
+			end := offset + s.PartSize
+			if end > s.FileSize {
+				end = s.FileSize
+			}
+			if _, err := s.UploadPart(sessionContent[offset:end], offset); err != nil {
+				t.Fatal("Expected the part to upload, got", err)
+			}
+		}
+
+		list, err := s.ListParts(1, 2)
+		if err != nil {
+			t.Fatal("Expected the parts to be listed, got", err)
+		}
+		if list.TotalCount != 4 || len(list.Entries) != 2 || list.Entries[0].Offset != 16 {
+			t.Error("Expected the second page of parts, got", list)
+		}
+
+		sum := sha1.Sum(sessionContent)
+		srv.DeferNextCommits(1)
+		file, err := s.CommitUpload(hex.EncodeToString(sum[:]))
+		if err != nil {
+			t.Fatal("Expected the commit to succeed, got", err)
+		}
+		got, _ := srv.Content(file.ID)
+		if file.Name != "big.bin" || !bytes.Equal(got, sessionContent) {
+			t.Error("Expected the assembled file, got", string(got))
+		}
+	})
+
+	t.Run("TestBadDigest", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+
+		s := sdk.NewSession()
+		if err := s.NewFile(boxtest.RootID, 16, "big.bin"); err != nil {
+			t.Fatal("Expected the session to start, got", err)
+		}
+		if _, err := s.UploadPart(sessionContent[:16], 0); err != nil {
+			t.Fatal("Expected the part to upload, got", err)
+		}
+		if _, err := s.CommitUpload(hex.EncodeToString(make([]byte, sha1.Size))); !hasStatus(err, http.StatusPreconditionFailed) {
+			t.Error("Expected the commit to be rejected, got", err)
+		}
+	})
+
+	t.Run("TestAbort", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+
+		s := sdk.NewSession()
+		if err := s.NewFile(boxtest.RootID, 60, "big.bin"); err != nil {
+			t.Fatal("Expected the session to start, got", err)
+		}
+		if err := s.Abort(); err != nil || srv.Sessions() != 0 {
+			t.Error("Expected the session to be aborted, got", err)
+		}
+	})
+
+	t.Run("TestNewVersion", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+		fileID := srv.AddFile(boxtest.RootID, "big.bin", []byte("old"))
+
+		s := sdk.NewSession()
+		if err := s.NewVersion(fileID, int64(len(sessionContent)), ""); err != nil {
+			t.Fatal("Expected the session to start, got", err)
+		}
+		file, err := s.Upload(bytes.NewReader(sessionContent))
+		if err != nil {
+			t.Fatal("Expected the upload to succeed, got", err)
+		}
+		got, _ := srv.Content(fileID)
+		if file.ID != fileID || !bytes.Equal(got, sessionContent) {
+			t.Error("Expected a new version of the file, got", string(got))
+		}
+	})
+}
+
+func TestChunkedUpload(t *testing.T) {
+	t.Run("TestReader", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+
+		file, err := sdk.ChunkedUpload(bytes.NewReader(sessionContent), int64(len(sessionContent)), "big.bin", boxtest.RootID)
+		if err != nil {
+			t.Fatal("Expected the upload to succeed, got", err)
+		}
+		if got, _ := srv.Content(file.ID); !bytes.Equal(got, sessionContent) {
+			t.Error("Expected the uploaded content, got", string(got))
+		}
+	})
+
+	t.Run("TestShortReader", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+
+		_, err := sdk.ChunkedUpload(bytes.NewReader(sessionContent[:20]), int64(len(sessionContent)), "big.bin", boxtest.RootID)
+		if err == nil {
+			t.Fatal("Expected the upload to fail")
+		}
+		if srv.Sessions() != 0 {
+			t.Error("Expected the session to be aborted")
+		}
+	})
+
+	t.Run("TestPath", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+
+		dir, err := ioutil.TempDir("", "box")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "local.bin")
+		if err := ioutil.WriteFile(path, sessionContent, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := sdk.ChunkedUploadFile(path, "", boxtest.RootID)
+		if err != nil {
+			t.Fatal("Expected the upload to succeed, got", err)
+		}
+		if got, _ := srv.Content(file.ID); file.Name != "local.bin" || !bytes.Equal(got, sessionContent) {
+			t.Error("Expected the file under its local name, got", file.Name)
+		}
+	})
+}
+
+func TestSessionResume(t *testing.T) {
+	t.Run("TestConcurrentParts", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+		sdk.SetUploadConcurrency(4)
+		srv.PartLatency = 20 * time.Millisecond
+
+		content := bytes.Repeat(sessionContent, 10)
+		s := sdk.NewSession()
+		if err := s.NewFile(boxtest.RootID, int64(len(content)), "big.bin"); err != nil {
+			t.Fatal("Expected the session to start, got", err)
+		}
+		if s.Concurrency != 4 {
+			t.Error("Expected the SDK's upload concurrency, got", s.Concurrency)
+		}
+		file, err := s.Upload(bytes.NewReader(content))
+		if err != nil {
+			t.Fatal("Expected the upload to succeed, got", err)
+		}
+		if got, _ := srv.Content(file.ID); !bytes.Equal(got, content) {
+			t.Error("Expected the uploaded content")
+		}
+		if got := srv.PeakParts(); got < 2 {
+			t.Error("Expected parts to be uploaded concurrently, got at most", got)
+		}
+	})
+
+	t.Run("TestResumeFromState", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+
+		s := sdk.NewSession()
+		if err := s.NewFile(boxtest.RootID, int64(len(sessionContent)), "big.bin"); err != nil {
+			t.Fatal("Expected the session to start, got", err)
+		}
+		var saved []byte
+		s.Checkpoint = func(state *SessionState) {
+			saved, _ = json.Marshal(state)
+		}
+		if _, err := s.UploadPart(sessionContent[:16], 0); err != nil {
+			t.Fatal("Expected the part to upload, got", err)
+		}
+		// The process crashes after sending a part it did not record.
+		s.Checkpoint = nil
+		if _, err := s.UploadPart(sessionContent[32:48], 32); err != nil {
+			t.Fatal("Expected the part to upload, got", err)
+		}
+
+		state := &SessionState{}
+		if err := json.Unmarshal(saved, state); err != nil || len(state.Parts) != 1 {
+			t.Fatal("Expected the saved state to hold one part, got", string(saved))
+		}
+		resumed, err := sdk.ResumeSession(state)
+		if err != nil {
+			t.Fatal("Expected the session to resume, got", err)
+		}
+		if len(resumed.Parts()) != 2 {
+			t.Fatal("Expected the parts Box received, got", resumed.Parts())
+		}
+
+		sent := 0
+		resumed.Checkpoint = func(*SessionState) { sent++ }
+		file, err := resumed.Upload(bytes.NewReader(sessionContent))
+		if err != nil {
+			t.Fatal("Expected the upload to succeed, got", err)
+		}
+		if sent != 2 {
+			t.Error("Expected only the missing parts to be sent, got", sent)
+		}
+		if got, _ := srv.Content(file.ID); !bytes.Equal(got, sessionContent) {
+			t.Error("Expected the uploaded content, got", string(got))
+		}
+	})
+
+	t.Run("TestResumeIfMatch", func(t *testing.T) {
+		sdk, srv := sessionSetup()
+		defer srv.Close()
+		fileID := srv.AddFile(boxtest.RootID, "big.bin", []byte("v1"))
+
+		s := sdk.NewSession()
+		s.IfMatch = "0"
+		if err := s.NewVersion(fileID, int64(len(sessionContent)), ""); err != nil {
+			t.Fatal("Expected the session to start, got", err)
+		}
+		saved, err := json.Marshal(s.State())
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.SetContent(fileID, []byte("concurrent edit"))
+
+		state := &SessionState{}
+		if err := json.Unmarshal(saved, state); err != nil {
+			t.Fatal(err)
+		}
+		resumed, err := sdk.ResumeSession(state)
+		if err != nil {
+			t.Fatal("Expected the session to resume, got", err)
+		}
+		if _, err := resumed.Upload(bytes.NewReader(sessionContent)); !IsPreconditionFailed(err) {
+			t.Error("Expected the resumed commit to check the etag, got", err)
+		}
+		if got, _ := srv.Content(fileID); string(got) != "concurrent edit" {
+			t.Error("Expected the concurrent edit to be kept, got", string(got))
+		}
+	})
+}
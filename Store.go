@@ -0,0 +1,143 @@
+package box
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// TokenStore persists access tokens, and their refresh tokens, so that they
+// survive restarts and can be shared between processes. Load returns nil
+// when the store is empty. Implementations must be safe for concurrent use.
+type TokenStore interface {
+	Load() (*AccessTokenObject, error)
+	Save(token *AccessTokenObject) error
+	Clear() error
+}
+
+// SetTokenStore makes the SDK load its token from store before requesting a
+// new one, and save every token it is issued there. Set the store before
+// making requests. Tokens of copies made by ForUser are not stored.
+func (sdk *SDK) SetTokenStore(store TokenStore) {
+	sdk.store = store
+	if ts, ok := sdk.tokens.(*cachedTokenSource); ok {
+		ts.store = store
+	}
+}
+
+// useTokens makes the SDK authenticate with tokens from fetch, persisted in
+// the SDK's TokenStore if it has one.
+func (sdk *SDK) useTokens(fetch tokenFetcher) *cachedTokenSource {
+	ts := newCachedTokenSource(fetch)
+	ts.store = sdk.store
+	sdk.tokens = ts
+	return ts
+}
+
+// MemoryTokenStore is a TokenStore that keeps the token in memory, for
+// sharing a token between SDK instances in the same process.
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	token *AccessTokenObject
+}
+
+// NewMemoryTokenStore returns an empty MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{}
+}
+
+// Load returns a copy of the stored token.
+func (s *MemoryTokenStore) Load() (*AccessTokenObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil {
+		return nil, nil
+	}
+	token := *s.token
+	return &token, nil
+}
+
+// Save stores a copy of token.
+func (s *MemoryTokenStore) Save(token *AccessTokenObject) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *token
+	s.token = &saved
+	return nil
+}
+
+// Clear empties the store.
+func (s *MemoryTokenStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = nil
+	return nil
+}
+
+// FileTokenStore is a TokenStore that keeps the token in a JSON file. The
+// file is replaced atomically, so processes sharing it never see a partial
+// write.
+type FileTokenStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileTokenStore returns a FileTokenStore backed by the file at path.
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{path: path}
+}
+
+// Load reads the token from the file. A missing file is an empty store.
+func (s *FileTokenStore) Load() (*AccessTokenObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	token := &AccessTokenObject{}
+	if err := json.Unmarshal(content, token); err != nil {
+		return nil, fmt.Errorf("box: parsing token file %s: %w", s.path, err)
+	}
+	return token, nil
+}
+
+// Save writes token to the file, readable only by its owner.
+func (s *FileTokenStore) Save(token *AccessTokenObject) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Clear removes the file.
+func (s *FileTokenStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package box
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileTokenStore(filepath.Join(dir, "token.json"))
+
+	if token, err := store.Load(); token != nil || err != nil {
+		t.Error("Expected an empty store, got", token, err)
+	}
+	if err := store.Save(&AccessTokenObject{AccessToken: "a", RefreshToken: "r"}); err != nil {
+		t.Fatal("Expected the token to be saved, got", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "token.json")); err != nil || info.Mode().Perm() != 0600 {
+		t.Error("Expected the token file to be private, got", info.Mode(), err)
+	}
+	if token, err := store.Load(); err != nil || token.AccessToken != "a" || token.RefreshToken != "r" {
+		t.Error("Expected the saved token, got", token, err)
+	}
+	if err := store.Clear(); err != nil {
+		t.Error("Expected the store to be cleared, got", err)
+	}
+	if err := store.Clear(); err != nil {
+		t.Error("Expected clearing an empty store to succeed, got", err)
+	}
+}
+
+func TestTokenStore(t *testing.T) {
+	t.Run("TestShared", func(t *testing.T) {
+		first, srv := setup()
+		defer srv.Close()
+		store := NewMemoryTokenStore()
+		first.SetTokenStore(store)
+		first.GetFolderInfo("0")
+
+		second, other := setup()
+		other.Close()
+		second.SetEndpoints(first.endpoints)
+		second.SetTokenStore(store)
+		if _, err := second.GetFolderInfo("0"); err != nil {
+			t.Fatal("Expected to receive Folder info, got", err)
+		}
+		if got := srv.TokenRequests(); got != 1 {
+			t.Errorf("Expected the stored token to be reused, got %d token requests", got)
+		}
+	})
+
+	t.Run("TestRejectedStoredToken", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		store := NewMemoryTokenStore()
+		sdk.SetTokenStore(store)
+		sdk.GetFolderInfo("0")
+		srv.ExpireTokens()
+
+		if _, err := sdk.GetFolderInfo("0"); err != nil {
+			t.Fatal("Expected the request to be re-authenticated, got", err)
+		}
+		stored, _ := store.Load()
+		current, _ := sdk.tokens.Token(context.Background())
+		if stored.AccessToken != current.AccessToken {
+			t.Error("Expected the new token to be stored")
+		}
+	})
+
+	t.Run("TestUserTokenRestart", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "box")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "token.json")
+
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.SetTokenStore(NewFileTokenStore(path))
+		first, err := sdk.ExchangeCode(srv.AuthCode(), "")
+		if err != nil {
+			t.Fatal("Expected the code to be exchanged, got", err)
+		}
+
+		restarted, other := setup()
+		other.Close()
+		restarted.SetEndpoints(sdk.endpoints)
+		restarted.SetTokenStore(NewFileTokenStore(path))
+		restarted.SetToken(nil)
+		if _, err := restarted.GetFolderInfo("0"); err != nil {
+			t.Fatal("Expected the stored token to be used, got", err)
+		}
+
+		srv.ExpireTokens()
+		if _, err := restarted.GetFolderInfo("0"); err != nil {
+			t.Fatal("Expected the stored refresh token to be used, got", err)
+		}
+		stored, _ := NewFileTokenStore(path).Load()
+		if stored.RefreshToken == first.RefreshToken {
+			t.Error("Expected the rotated refresh token to be stored")
+		}
+
+		if err := restarted.RevokeToken(); err != nil {
+			t.Fatal("Expected the token to be revoked, got", err)
+		}
+		if stored, _ := NewFileTokenStore(path).Load(); stored != nil {
+			t.Error("Expected revoking to clear the store")
+		}
+	})
+}
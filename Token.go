@@ -0,0 +1,167 @@
+package box
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// expiryMargin is how long before its expiry a token is refreshed.
+const expiryMargin = time.Minute
+
+// TokenSource supplies the access tokens used to authenticate requests.
+// Implementations must be safe for concurrent use.
+type TokenSource interface {
+	Token(ctx context.Context) (*AccessTokenObject, error)
+}
+
+// tokenInvalidator is implemented by token sources that can discard a token
+// the Box API has rejected, fetch a new one on demand, or forget their tokens
+// altogether.
+type tokenInvalidator interface {
+	invalidate(token *AccessTokenObject)
+	refresh(ctx context.Context) (*AccessTokenObject, error)
+	forget() error
+}
+
+// tokenFetcher requests a new access token from the Box API. previous is the
+// last token known to the source, if any, for grants that need its refresh
+// token.
+type tokenFetcher func(ctx context.Context, previous *AccessTokenObject) (*AccessTokenObject, error)
+
+// valid reports whether the token can still be used, refreshing ahead of its
+// expiry by expiryMargin or by half its lifetime for short-lived tokens.
+func (token *AccessTokenObject) valid() bool {
+	if token == nil || token.AccessToken == "" {
+		return false
+	}
+	if token.Expiry.IsZero() {
+		return true
+	}
+	margin := expiryMargin
+	if lifetime := time.Duration(token.ExpiresIn) * time.Second; lifetime < 2*margin {
+		margin = lifetime / 2
+	}
+	return time.Now().Add(margin).Before(token.Expiry)
+}
+
+// cachedTokenSource reuses a token until it is about to expire. Refreshes are
+// serialised so that concurrent callers share a single token request. With a
+// store, tokens are shared with other processes using the same store.
+type cachedTokenSource struct {
+	fetch    tokenFetcher
+	store    TokenStore
+	sem      chan struct{}
+	token    *AccessTokenObject
+	rejected string
+}
+
+// newCachedTokenSource returns a TokenSource that refreshes lazily with fetch.
+func newCachedTokenSource(fetch tokenFetcher) *cachedTokenSource {
+	return &cachedTokenSource{fetch: fetch, sem: make(chan struct{}, 1)}
+}
+
+// Token returns the cached token, fetching a new one if it has expired.
+func (ts *cachedTokenSource) Token(ctx context.Context) (*AccessTokenObject, error) {
+	return ts.get(ctx, false)
+}
+
+// refresh fetches a new token even if the cached one is still valid.
+func (ts *cachedTokenSource) refresh(ctx context.Context) (*AccessTokenObject, error) {
+	return ts.get(ctx, true)
+}
+
+func (ts *cachedTokenSource) get(ctx context.Context, force bool) (*AccessTokenObject, error) {
+	select {
+	case ts.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-ts.sem }()
+
+	if !force && ts.usable(ts.token) {
+		return ts.token, nil
+	}
+
+	previous := ts.token
+	if ts.store != nil {
+		stored, err := ts.store.Load()
+		if err != nil {
+			return nil, fmt.Errorf("box: loading token: %w", err)
+		}
+		if stored != nil {
+			// Another process may already have refreshed the token.
+			if !force && ts.usable(stored) {
+				ts.token = stored
+				return stored, nil
+			}
+			previous = stored
+		}
+	}
+
+	token, err := ts.fetch(ctx, previous)
+	if err != nil {
+		return nil, err
+	}
+	ts.token = token
+	if ts.store != nil {
+		if err := ts.store.Save(token); err != nil {
+			return nil, fmt.Errorf("box: saving token: %w", err)
+		}
+	}
+	return token, nil
+}
+
+// usable reports whether token is valid and has not been rejected.
+func (ts *cachedTokenSource) usable(token *AccessTokenObject) bool {
+	return token.valid() && token.AccessToken != ts.rejected
+}
+
+// invalidate marks token as rejected, so that the next call to Token fetches
+// a new one. Its refresh token, if any, is still used for that.
+func (ts *cachedTokenSource) invalidate(token *AccessTokenObject) {
+	ts.sem <- struct{}{}
+	if token != nil {
+		ts.rejected = token.AccessToken
+	}
+	<-ts.sem
+}
+
+// forget drops the cached token and clears the store.
+func (ts *cachedTokenSource) forget() error {
+	ts.sem <- struct{}{}
+	defer func() { <-ts.sem }()
+	ts.token = nil
+	if ts.store != nil {
+		if err := ts.store.Clear(); err != nil {
+			return fmt.Errorf("box: clearing token: %w", err)
+		}
+	}
+	return nil
+}
+
+// requestToken posts a grant to the OAuth 2.0 token endpoint and returns the
+// issued token with its expiry set.
+func (sdk *SDK) requestToken(ctx context.Context, form url.Values) (*AccessTokenObject, error) {
+	if sdk.config == nil {
+		return nil, errConfig
+	}
+	header := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+
+	issued := time.Now()
+	response, err := sdk.call(ctx, "POST", sdk.tokenURL(), bytes.NewBufferString(form.Encode()), header, false)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &AccessTokenObject{}
+	if err := unmarshal(response, token); err != nil {
+		return nil, fmt.Errorf("box: parsing access token: %w", err)
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = issued.Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
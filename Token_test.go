@@ -0,0 +1,102 @@
+package box
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenValid(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		token *AccessTokenObject
+		want  bool
+	}{
+		{"TestNil", nil, false},
+		{"TestNoExpiry", &AccessTokenObject{AccessToken: "a"}, true},
+		{"TestFresh", &AccessTokenObject{AccessToken: "a", ExpiresIn: 3600, Expiry: now.Add(time.Hour)}, true},
+		{"TestWithinMargin", &AccessTokenObject{AccessToken: "a", ExpiresIn: 3600, Expiry: now.Add(30 * time.Second)}, false},
+		{"TestShortLived", &AccessTokenObject{AccessToken: "a", ExpiresIn: 10, Expiry: now.Add(8 * time.Second)}, true},
+		{"TestExpired", &AccessTokenObject{AccessToken: "a", ExpiresIn: 10, Expiry: now.Add(-time.Second)}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.token.valid(); got != test.want {
+				t.Errorf("Expected valid() to be %v", test.want)
+			}
+		})
+	}
+}
+
+func TestTokenLifecycle(t *testing.T) {
+	t.Run("TestLazy", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		if _, err := sdk.GetFolderInfo("0"); err != nil {
+			t.Fatal("Expected a token to be fetched on demand, got", err)
+		}
+		sdk.GetFolderInfo("0")
+		if got := srv.TokenRequests(); got != 1 {
+			t.Errorf("Expected the token to be reused, got %d token requests", got)
+		}
+	})
+
+	t.Run("TestConcurrent", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := sdk.GetFolderInfo("0"); err != nil {
+					t.Error("Expected folder info, got", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if got := srv.TokenRequests(); got != 1 {
+			t.Errorf("Expected concurrent refreshes to be serialised, got %d token requests", got)
+		}
+	})
+
+	t.Run("TestExpired", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		srv.TokenLifetime = 1
+		sdk.GetFolderInfo("0")
+		time.Sleep(600 * time.Millisecond)
+		sdk.GetFolderInfo("0")
+		if got := srv.TokenRequests(); got != 2 {
+			t.Errorf("Expected the token to be refreshed before expiry, got %d token requests", got)
+		}
+	})
+
+	t.Run("TestUnauthorized", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		sdk.GetFolderInfo("0")
+		srv.ExpireTokens()
+		if _, err := sdk.CreateFolder("docs", "0"); err != nil {
+			t.Fatal("Expected the request to be re-authenticated, got", err)
+		}
+		if got := srv.TokenRequests(); got != 2 {
+			t.Errorf("Expected one new token, got %d token requests", got)
+		}
+	})
+
+	t.Run("TestRequestAccessToken", func(t *testing.T) {
+		sdk, srv := setup()
+		defer srv.Close()
+		first, _ := sdk.tokens.Token(context.Background())
+		if err := sdk.RequestAccessToken(); err != nil {
+			t.Fatal("Expected an access token, got", err)
+		}
+		second, _ := sdk.tokens.Token(context.Background())
+		if first.AccessToken == second.AccessToken {
+			t.Error("Expected RequestAccessToken to fetch a new token")
+		}
+	})
+}
@@ -0,0 +1,1145 @@
+// Package boxtest provides an in-process fake of the Box API so that the SDK
+// can be tested without network access or real credentials.
+package boxtest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PublicKeyID is the key ID the fake expects in JWT assertions.
+	PublicKeyID = "boxtest"
+	// Passphrase protects the key returned by PrivateKey.
+	Passphrase = "boxtest"
+	// RootID is the ID of the root "All Files" folder.
+	RootID = "0"
+)
+
+var (
+	keyOnce sync.Once
+	keyPEM  string
+)
+
+// PrivateKey returns a PEM encoded RSA key, encrypted with Passphrase, that
+// can be used in a box.Config pointed at the fake server.
+func PrivateKey() string {
+	keyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY",
+			x509.MarshalPKCS1PrivateKey(key), []byte(Passphrase), x509.PEMCipherAES256)
+		if err != nil {
+			panic(err)
+		}
+		keyPEM = string(pem.EncodeToMemory(block))
+	})
+	return keyPEM
+}
+
+// node is a file or folder held in the fake's in-memory tree.
+type node struct {
+	typ      string
+	id       string
+	name     string
+	parent   string
+	etag     int
+	content  []byte
+	created  time.Time
+	modified time.Time
+
+	// contentCreated and contentModified are the client-side timestamps
+	// given at upload, if any.
+	contentCreated  string
+	contentModified string
+
+	// version is the ID of a file's current version, and versions are its
+	// previous versions, oldest first.
+	version  string
+	versions []*fileVersion
+
+	// extra holds the fields set by updates, rendered as they were given.
+	extra map[string]interface{}
+}
+
+// fileVersion is a previous version of a file.
+type fileVersion struct {
+	id       string
+	name     string
+	content  []byte
+	created  time.Time
+	trashed  time.Time
+	restored time.Time
+}
+
+func (n *node) sha1() string {
+	sum := sha1.Sum(n.content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Server is a fake Box API. It serves the API, upload and OAuth endpoints
+// from a single httptest server and keeps its files and folders in memory.
+type Server struct {
+	*httptest.Server
+
+	// ClientID and ClientSecret, when set, must match the values sent to the
+	// token endpoint.
+	ClientID     string
+	ClientSecret string
+
+	// TokenLifetime is the expires_in of issued tokens, in seconds. Defaults
+	// to an hour.
+	TokenLifetime int
+
+	// Quota is the storage available to the account, in bytes. Uploads that
+	// would exceed it are rejected. Zero means unlimited.
+	Quota int
+
+	// PartSize is the part size of chunked upload sessions, in bytes.
+	// Defaults to 8MB.
+	PartSize int
+
+	// PartLatency delays every part upload before it is handled, so that
+	// part uploads sent concurrently overlap.
+	PartLatency time.Duration
+
+	mu       sync.Mutex
+	items    map[string]*node
+	tokens   map[string]string
+	refresh  map[string]string
+	codes    map[string]bool
+	nextID   int
+	reqID    int
+	requests int
+	header   http.Header
+	length   int64
+	grants   int
+	failures []failure
+	cut      int
+	corrupt  bool
+	sessions map[string]*session
+	deferred int
+	readOnly map[string]bool
+
+	// partMu guards the count of part uploads in flight, which are counted
+	// before mu is taken.
+	partMu      sync.Mutex
+	partsActive int
+	partsPeak   int
+}
+
+// failure is an injected error response.
+type failure struct {
+	status     int
+	retryAfter int
+}
+
+// NewServer starts a fake Box API containing only the root folder.
+func NewServer() *Server {
+	now := time.Now().UTC()
+	s := &Server{
+		items: map[string]*node{
+			RootID: {typ: "folder", id: RootID, name: "All Files", created: now, modified: now},
+		},
+		tokens:   make(map[string]string),
+		refresh:  make(map[string]string),
+		codes:    make(map[string]bool),
+		sessions: make(map[string]*session),
+		readOnly: make(map[string]bool),
+		nextID:   1000,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// APIURL is the base URL of the fake's content API.
+func (s *Server) APIURL() string { return s.URL + "/2.0" }
+
+// UploadURL is the base URL of the fake's upload API.
+func (s *Server) UploadURL() string { return s.URL + "/api/2.0" }
+
+// OAuthURL is the base URL of the fake's OAuth 2.0 endpoints.
+func (s *Server) OAuthURL() string { return s.URL + "/oauth2" }
+
+// Client returns an HTTP client that sends requests addressed to the real
+// Box hosts to the fake instead.
+func (s *Server) Client() *http.Client {
+	return &http.Client{Transport: &rewriteTransport{
+		host: strings.TrimPrefix(s.URL, "http://"),
+		base: s.Server.Client().Transport,
+	}}
+}
+
+// rewriteTransport redirects requests for Box hosts to the fake server.
+type rewriteTransport struct {
+	host string
+	base http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.URL.Host {
+	case "api.box.com", "upload.box.com", "account.box.com":
+		req = req.Clone(req.Context())
+		req.URL.Scheme = "http"
+		req.URL.Host = t.host
+		req.Host = t.host
+	}
+	return t.base.RoundTrip(req)
+}
+
+// AddFolder creates a folder under parentID and returns its ID.
+func (s *Server) AddFolder(parentID, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create("folder", parentID, name, nil).id
+}
+
+// AddFile creates a file under parentID and returns its ID.
+func (s *Server) AddFile(parentID, name string, content []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create("file", parentID, name, content).id
+}
+
+// Content returns the content of the file with the given ID.
+func (s *Server) Content(fileID string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.items[fileID]
+	if !ok || n.typ != "file" {
+		return nil, false
+	}
+	return append([]byte(nil), n.content...), true
+}
+
+// SetContent replaces the content of the file with the given ID, as if a
+// new version had been uploaded.
+func (s *Server) SetContent(fileID string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.items[fileID]; ok && n.typ == "file" {
+		s.replace(n, append([]byte(nil), content...))
+	}
+}
+
+// CutNextDownload drops the connection of the next file download after n
+// bytes of content, as a flaky network would.
+func (s *Server) CutNextDownload(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cut = n
+}
+
+// CorruptNextDownload changes the first byte of the next file download, as
+// a faulty proxy would.
+func (s *Server) CorruptNextDownload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.corrupt = true
+}
+
+// SetReadOnly makes the folder with the given ID reject uploads, as if the
+// user only had viewer access.
+func (s *Server) SetReadOnly(folderID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readOnly[folderID] = true
+}
+
+// FailNext makes the next n requests fail with the given status. When
+// retryAfter is positive it is sent as a Retry-After header in seconds.
+func (s *Server) FailNext(n, status, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, failure{status, retryAfter})
+	}
+}
+
+// LastHeader returns the headers of the most recent request.
+func (s *Server) LastHeader() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.header.Clone()
+}
+
+// LastContentLength returns the Content-Length of the most recent request,
+// or -1 if its body was sent without one.
+func (s *Server) LastContentLength() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.length
+}
+
+// Requests returns the number of requests the fake has received.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// AuthCode returns a new authorization code, as if a user had granted
+// access to the app, that can be exchanged once at the token endpoint.
+func (s *Server) AuthCode() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqID++
+	code := fmt.Sprintf("boxtest-code-%d", s.reqID)
+	s.codes[code] = true
+	return code
+}
+
+// TokenSubject returns who an access token was issued for, as
+// "enterprise:<id>" or "user:<id>", or "" for OAuth 2.0 user tokens.
+func (s *Server) TokenSubject(token string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[token]
+}
+
+// TokenRequests returns the number of tokens the fake has issued.
+func (s *Server) TokenRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.grants
+}
+
+// ExpireTokens revokes every issued access token, so that the next API
+// request using one of them is answered with a 401.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]string)
+}
+
+// Exists reports whether an item with the given ID exists.
+func (s *Server) Exists(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.items[id]
+	return ok
+}
+
+// create adds a new node. The caller must hold s.mu.
+func (s *Server) create(typ, parentID, name string, content []byte) *node {
+	s.nextID++
+	now := time.Now().UTC()
+	n := &node{
+		typ:      typ,
+		id:       strconv.Itoa(s.nextID),
+		name:     name,
+		parent:   parentID,
+		content:  content,
+		created:  now,
+		modified: now,
+	}
+	if typ == "file" {
+		n.version = s.newVersionID()
+	}
+	s.items[n.id] = n
+	return n
+}
+
+// newVersionID returns the ID for a new file version. The caller must hold
+// s.mu.
+func (s *Server) newVersionID() string {
+	s.nextID++
+	return "V" + strconv.Itoa(s.nextID)
+}
+
+// replace makes content the current version of the file n, keeping the
+// previous version in its history. The caller must hold s.mu.
+func (s *Server) replace(n *node, content []byte) {
+	n.versions = append(n.versions, &fileVersion{
+		id:      n.version,
+		name:    n.name,
+		content: n.content,
+		created: n.modified,
+	})
+	n.version = s.newVersionID()
+	n.content = content
+	n.etag++
+	n.modified = time.Now().UTC()
+}
+
+// children returns the items in a folder sorted by name. The caller must hold
+// s.mu.
+func (s *Server) children(folderID string) []*node {
+	var list []*node
+	for _, n := range s.items {
+		if n.parent == folderID && n.id != RootID {
+			list = append(list, n)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+// lookup finds an item by name within a folder. The caller must hold s.mu.
+func (s *Server) lookup(folderID, name string) *node {
+	for _, n := range s.children(folderID) {
+		if n.name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// mini renders the short form of an item used in collections.
+func (s *Server) mini(n *node) map[string]interface{} {
+	m := map[string]interface{}{
+		"type":        n.typ,
+		"id":          n.id,
+		"etag":        strconv.Itoa(n.etag),
+		"sequence_id": strconv.Itoa(n.etag),
+		"name":        n.name,
+	}
+	if n.typ == "file" {
+		m["sha1"] = n.sha1()
+	}
+	if n.id == RootID {
+		delete(m, "etag")
+		delete(m, "sequence_id")
+	}
+	return m
+}
+
+// full renders the standard form of an item. The caller must hold s.mu.
+func (s *Server) full(n *node) map[string]interface{} {
+	m := s.mini(n)
+	m["size"] = len(n.content)
+	m["created_at"] = n.created.Format(time.RFC3339)
+	m["modified_at"] = n.modified.Format(time.RFC3339)
+	m["item_status"] = "active"
+	for k, v := range n.extra {
+		m[k] = v
+	}
+	if n.contentCreated != "" {
+		m["content_created_at"] = n.contentCreated
+	}
+	if n.contentModified != "" {
+		m["content_modified_at"] = n.contentModified
+	}
+
+	var path []map[string]interface{}
+	for p := s.items[n.parent]; p != nil && n.id != RootID; p = s.items[p.parent] {
+		path = append([]map[string]interface{}{s.mini(p)}, path...)
+		if p.id == RootID {
+			break
+		}
+	}
+	m["path_collection"] = map[string]interface{}{"total_count": len(path), "entries": path}
+	if n.id != RootID {
+		m["parent"] = s.mini(s.items[n.parent])
+	}
+
+	if n.typ == "folder" {
+		entries := []map[string]interface{}{}
+		for _, c := range s.children(n.id) {
+			entries = append(entries, s.mini(c))
+		}
+		m["item_collection"] = map[string]interface{}{
+			"total_count": len(entries),
+			"entries":     entries,
+			"offset":      0,
+			"limit":       100,
+		}
+	} else {
+		m["file_version"] = map[string]interface{}{
+			"type": "file_version",
+			"id":   n.version,
+			"sha1": n.sha1(),
+		}
+	}
+	return m
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error body in the format used by the Box API.
+func (s *Server) writeError(w http.ResponseWriter, status int, code, message string, context map[string]interface{}) {
+	s.reqID++
+	body := map[string]interface{}{
+		"type":       "error",
+		"status":     status,
+		"code":       code,
+		"message":    message,
+		"help_url":   "http://developers.box.com/docs/#errors",
+		"request_id": "boxtest" + strconv.Itoa(s.reqID),
+	}
+	if context != nil {
+		body["context_info"] = context
+	}
+	s.writeJSON(w, status, body)
+}
+
+// handle counts the part uploads in flight and serves the request.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/files/upload_sessions/") {
+		s.partStarted()
+		defer s.partDone()
+		time.Sleep(s.PartLatency)
+	}
+	s.serve(w, r)
+}
+
+// serve routes a request to the matching fake endpoint.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	s.header = r.Header.Clone()
+	s.length = r.ContentLength
+	if len(s.failures) > 0 {
+		f := s.failures[0]
+		s.failures = s.failures[1:]
+		if f.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(f.retryAfter))
+		}
+		s.writeError(w, f.status, strings.ToLower(strings.Replace(http.StatusText(f.status), " ", "_", -1)),
+			http.StatusText(f.status), nil)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/oauth2/token":
+		s.token(w, r)
+		return
+	case "/oauth2/revoke":
+		s.revoke(w, r)
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	var upload bool
+	switch {
+	case strings.HasPrefix(path, "2.0/"):
+		path = strings.TrimPrefix(path, "2.0/")
+	case strings.HasPrefix(path, "api/2.0/"):
+		path = strings.TrimPrefix(path, "api/2.0/")
+		upload = true
+	default:
+		s.writeError(w, http.StatusNotFound, "not_found", "Not Found", nil)
+		return
+	}
+
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, ok := s.tokens[auth]; !ok {
+		s.writeError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized", nil)
+		return
+	}
+
+	seg := strings.Split(path, "/")
+	switch {
+	case upload && r.Method == http.MethodPost && path == "files/content":
+		s.uploadFile(w, r)
+	case upload && r.Method == http.MethodPost && len(seg) == 3 && seg[0] == "files" && seg[2] == "content":
+		s.uploadVersion(w, r, seg[1])
+	case !upload && r.Method == http.MethodOptions && path == "files/content":
+		s.preflight(w, r)
+	case upload && seg[0] == "files" && len(seg) > 1 && seg[1] == "upload_sessions":
+		s.uploadSessions(w, r, seg[2:])
+	case upload && r.Method == http.MethodPost && len(seg) == 3 && seg[0] == "files" && seg[2] == "upload_sessions":
+		s.createSession(w, r, seg[1])
+	case !upload && seg[0] == "files" && len(seg) > 1:
+		s.files(w, r, seg[1:])
+	case !upload && seg[0] == "folders":
+		s.folders(w, r, seg[1:])
+	default:
+		s.writeError(w, http.StatusNotFound, "not_found", "Not Found", nil)
+	}
+}
+
+// grantError writes an OAuth 2.0 error response.
+func (s *Server) grantError(w http.ResponseWriter, code, description string) {
+	s.writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// checkClient verifies the client credentials sent to an OAuth 2.0 endpoint.
+func (s *Server) checkClient(w http.ResponseWriter, r *http.Request) bool {
+	r.ParseForm()
+	if (s.ClientID != "" && r.PostForm.Get("client_id") != s.ClientID) ||
+		(s.ClientSecret != "" && r.PostForm.Get("client_secret") != s.ClientSecret) {
+		s.grantError(w, "invalid_client", "The client credentials are invalid")
+		return false
+	}
+	return true
+}
+
+// token implements the OAuth 2.0 token endpoint.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed", nil)
+		return
+	}
+	// Token exchange is authorized by the subject token alone.
+	r.ParseForm()
+	grant := r.PostForm.Get("grant_type")
+	if grant != "urn:ietf:params:oauth:grant-type:token-exchange" && !s.checkClient(w, r) {
+		return
+	}
+
+	switch grant {
+	case "urn:ietf:params:oauth:grant-type:jwt-bearer":
+		claims, ok := assertionClaims(r.PostForm.Get("assertion"))
+		if !ok || claims.Subject == "" {
+			s.grantError(w, "invalid_grant", "Invalid JWT assertion")
+			return
+		}
+		s.issue(w, claims.SubjectType+":"+claims.Subject, false)
+	case "client_credentials":
+		subjectType, subjectID := r.PostForm.Get("box_subject_type"), r.PostForm.Get("box_subject_id")
+		if (subjectType != "enterprise" && subjectType != "user") || subjectID == "" {
+			s.grantError(w, "invalid_grant", "Grant credentials are invalid")
+			return
+		}
+		s.issue(w, subjectType+":"+subjectID, false)
+	case "urn:ietf:params:oauth:grant-type:token-exchange":
+		s.exchange(w, r)
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		if !s.codes[code] {
+			s.grantError(w, "invalid_grant", "Auth code doesn't exist or is invalid for the client")
+			return
+		}
+		delete(s.codes, code)
+		s.issue(w, "", true)
+	case "refresh_token":
+		refresh := r.PostForm.Get("refresh_token")
+		if _, ok := s.refresh[refresh]; !ok {
+			s.grantError(w, "invalid_grant", "Invalid refresh token")
+			return
+		}
+		delete(s.refresh, refresh)
+		s.issue(w, "", true)
+	default:
+		s.grantError(w, "unsupported_grant_type", "Grant type is not supported")
+	}
+}
+
+// exchange issues a downscoped token for a valid subject token.
+func (s *Server) exchange(w http.ResponseWriter, r *http.Request) {
+	subject, ok := s.tokens[r.PostForm.Get("subject_token")]
+	if !ok || r.PostForm.Get("subject_token_type") != "urn:ietf:params:oauth:token-type:access_token" {
+		s.grantError(w, "invalid_grant", "Invalid subject token")
+		return
+	}
+	scopes := strings.Fields(r.PostForm.Get("scope"))
+	if len(scopes) == 0 {
+		s.grantError(w, "invalid_scope", "No scope was requested")
+		return
+	}
+
+	var object map[string]interface{}
+	if resource := r.PostForm.Get("resource"); resource != "" {
+		seg := strings.Split(strings.TrimPrefix(resource, "https://api.box.com/2.0/"), "/")
+		var n *node
+		if len(seg) == 2 && (seg[0] == "files" || seg[0] == "folders") {
+			n = s.items[seg[1]]
+		}
+		if n == nil || n.typ+"s" != seg[0] {
+			s.grantError(w, "invalid_resource", "The target resource is invalid")
+			return
+		}
+		object = s.mini(n)
+	}
+
+	restricted := []interface{}{}
+	for _, scope := range scopes {
+		entry := map[string]interface{}{"scope": scope}
+		if object != nil {
+			entry["object"] = object
+		}
+		restricted = append(restricted, entry)
+	}
+	s.reqID++
+	s.grants++
+	token := fmt.Sprintf("boxtest-token-%d", s.reqID)
+	s.tokens[token] = subject
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":      token,
+		"expires_in":        s.lifetime(),
+		"issued_token_type": "urn:ietf:params:oauth:token-type:access_token",
+		"restricted_to":     restricted,
+		"token_type":        "bearer",
+	})
+}
+
+// lifetime returns the expires_in of issued tokens.
+func (s *Server) lifetime() int {
+	if s.TokenLifetime == 0 {
+		return 3600
+	}
+	return s.TokenLifetime
+}
+
+// issue writes a newly issued access token for subject, with a refresh token
+// if asked.
+func (s *Server) issue(w http.ResponseWriter, subject string, refresh bool) {
+	s.reqID++
+	s.grants++
+	token := fmt.Sprintf("boxtest-token-%d", s.reqID)
+	s.tokens[token] = subject
+	body := map[string]interface{}{
+		"access_token":  token,
+		"expires_in":    s.lifetime(),
+		"restricted_to": []interface{}{},
+		"token_type":    "bearer",
+	}
+	if refresh {
+		refreshToken := fmt.Sprintf("boxtest-refresh-%d", s.reqID)
+		s.refresh[refreshToken] = token
+		body["refresh_token"] = refreshToken
+	}
+	s.writeJSON(w, http.StatusOK, body)
+}
+
+// claims are the JWT assertion claims the fake inspects.
+type claims struct {
+	Subject     string `json:"sub"`
+	SubjectType string `json:"box_sub_type"`
+}
+
+// assertionClaims decodes the claims of a JWT assertion without verifying its
+// signature.
+func assertionClaims(assertion string) (*claims, bool) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, false
+	}
+	c := &claims{}
+	if json.Unmarshal(payload, c) != nil {
+		return nil, false
+	}
+	return c, true
+}
+
+// revoke implements the OAuth 2.0 revoke endpoint. Revoking either token of
+// a pair revokes both.
+func (s *Server) revoke(w http.ResponseWriter, r *http.Request) {
+	if !s.checkClient(w, r) {
+		return
+	}
+	token := r.PostForm.Get("token")
+	if access, ok := s.refresh[token]; ok {
+		delete(s.tokens, access)
+		delete(s.refresh, token)
+	}
+	for refresh, access := range s.refresh {
+		if access == token {
+			delete(s.refresh, refresh)
+		}
+	}
+	delete(s.tokens, token)
+	w.WriteHeader(http.StatusOK)
+}
+
+// decode reads a JSON request body into v, writing an error on failure.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Invalid JSON body: "+err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+// cutWriter writes only the first left bytes of a response body.
+type cutWriter struct {
+	http.ResponseWriter
+	left int
+}
+
+func (w *cutWriter) Write(p []byte) (int, error) {
+	if len(p) > w.left {
+		p = p[:w.left]
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.left -= n
+	if err == nil && w.left == 0 {
+		if f, ok := w.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+		return n, io.ErrShortWrite
+	}
+	return n, err
+}
+
+// checkEtag enforces an If-Match precondition against n.
+func (s *Server) checkEtag(w http.ResponseWriter, r *http.Request, n *node) bool {
+	if etag := r.Header.Get("If-Match"); etag != "" && etag != strconv.Itoa(n.etag) {
+		s.writeError(w, http.StatusPreconditionFailed, "precondition_failed", "The resource has been modified", nil)
+		return false
+	}
+	return true
+}
+
+// find returns the item with the given ID and type, writing a 404 if absent.
+func (s *Server) find(w http.ResponseWriter, typ, id string) *node {
+	n, ok := s.items[id]
+	if !ok || n.typ != typ {
+		s.writeError(w, http.StatusNotFound, "not_found", "Not Found", nil)
+		return nil
+	}
+	return n
+}
+
+// target holds the destination fields accepted by create and copy calls.
+type target struct {
+	Name   string `json:"name"`
+	Parent struct {
+		ID string `json:"id"`
+	} `json:"parent"`
+}
+
+// files implements the /files endpoints.
+func (s *Server) files(w http.ResponseWriter, r *http.Request, seg []string) {
+	n := s.find(w, "file", seg[0])
+	if n == nil {
+		return
+	}
+
+	switch {
+	case len(seg) == 1 && r.Method == http.MethodGet:
+		s.writeJSON(w, http.StatusOK, s.full(n))
+	case len(seg) == 1 && r.Method == http.MethodPut:
+		s.update(w, r, n)
+	case len(seg) == 1 && r.Method == http.MethodDelete:
+		if !s.checkEtag(w, r, n) {
+			return
+		}
+		delete(s.items, n.id)
+		w.WriteHeader(http.StatusNoContent)
+	case len(seg) >= 2 && seg[1] == "versions":
+		s.fileVersions(w, r, n, seg[2:])
+	case len(seg) == 2 && seg[1] == "content" && r.Method == http.MethodGet && r.URL.Query().Get("version") != "":
+		v := s.findVersion(w, n, r.URL.Query().Get("version"))
+		if v == nil {
+			return
+		}
+		if !v.trashed.IsZero() {
+			s.writeError(w, http.StatusNotFound, "not_found", "Version is trashed", nil)
+			return
+		}
+		w.Header().Set("ETag", `"`+v.id+`"`)
+		http.ServeContent(w, r, v.name, v.created, strings.NewReader(string(v.content)))
+	case len(seg) == 2 && seg[1] == "content" && r.Method == http.MethodGet:
+		w.Header().Set("ETag", `"`+strconv.Itoa(n.etag)+`"`)
+		content := n.content
+		if s.corrupt && len(content) > 0 {
+			s.corrupt = false
+			content = append([]byte(nil), content...)
+			content[0]++
+		}
+		if s.cut > 0 {
+			cut := &cutWriter{ResponseWriter: w, left: s.cut}
+			s.cut = 0
+			http.ServeContent(cut, r, n.name, n.modified, bytes.NewReader(content))
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, n.name, n.modified, bytes.NewReader(content))
+	case len(seg) == 2 && seg[1] == "copy" && r.Method == http.MethodPost:
+		var req target
+		if !s.decode(w, r, &req) {
+			return
+		}
+		if req.Name == "" {
+			req.Name = n.name
+		}
+		if s.conflict(w, req.Parent.ID, req.Name, false) {
+			return
+		}
+		c := s.create("file", req.Parent.ID, req.Name, append([]byte(nil), n.content...))
+		s.writeJSON(w, http.StatusCreated, s.full(c))
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed", nil)
+	}
+}
+
+// conflict writes a 409 if parentID is missing or already holds name. Folder
+// conflicts are reported as a list, as the real API does.
+func (s *Server) conflict(w http.ResponseWriter, parentID, name string, list bool) bool {
+	if p, ok := s.items[parentID]; !ok || p.typ != "folder" {
+		s.writeError(w, http.StatusNotFound, "not_found", "Parent folder not found", nil)
+		return true
+	}
+	existing := s.lookup(parentID, name)
+	if existing == nil {
+		return false
+	}
+	var conflicts interface{} = s.mini(existing)
+	if list {
+		conflicts = []interface{}{conflicts}
+	}
+	s.writeError(w, http.StatusConflict, "item_name_in_use", "Item with the same name already exists",
+		map[string]interface{}{"conflicts": conflicts})
+	return true
+}
+
+// folders implements the /folders endpoints.
+func (s *Server) folders(w http.ResponseWriter, r *http.Request, seg []string) {
+	if len(seg) == 0 || seg[0] == "" {
+		if r.Method != http.MethodPost {
+			s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed", nil)
+			return
+		}
+		var req target
+		if !s.decode(w, r, &req) || s.conflict(w, req.Parent.ID, req.Name, true) {
+			return
+		}
+		s.writeJSON(w, http.StatusCreated, s.full(s.create("folder", req.Parent.ID, req.Name, nil)))
+		return
+	}
+
+	n := s.find(w, "folder", seg[0])
+	if n == nil {
+		return
+	}
+
+	switch {
+	case len(seg) == 1 && r.Method == http.MethodGet:
+		s.writeJSON(w, http.StatusOK, s.full(n))
+	case len(seg) == 1 && r.Method == http.MethodPut && n.id != RootID:
+		s.update(w, r, n)
+	case len(seg) == 1 && r.Method == http.MethodDelete:
+		if !s.checkEtag(w, r, n) {
+			return
+		}
+		if len(s.children(n.id)) > 0 && r.URL.Query().Get("recursive") != "true" {
+			s.writeError(w, http.StatusBadRequest, "folder_not_empty", "Folder is not empty", nil)
+			return
+		}
+		s.remove(n)
+		w.WriteHeader(http.StatusNoContent)
+	case len(seg) == 2 && seg[1] == "items" && r.Method == http.MethodGet:
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if limit <= 0 {
+			limit = 100
+		}
+		children := s.children(n.id)
+		entries := []map[string]interface{}{}
+		for i := offset; i < len(children) && i < offset+limit; i++ {
+			entries = append(entries, s.mini(children[i]))
+		}
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"total_count": len(children),
+			"entries":     entries,
+			"offset":      offset,
+			"limit":       limit,
+		})
+	case len(seg) == 2 && seg[1] == "copy" && r.Method == http.MethodPost:
+		var req target
+		if !s.decode(w, r, &req) {
+			return
+		}
+		if req.Name == "" {
+			req.Name = n.name
+		}
+		if s.conflict(w, req.Parent.ID, req.Name, true) {
+			return
+		}
+		s.writeJSON(w, http.StatusCreated, s.full(s.copyTree(n, req.Parent.ID, req.Name)))
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed", nil)
+	}
+}
+
+// remove deletes n and everything below it. The caller must hold s.mu.
+func (s *Server) remove(n *node) {
+	for _, c := range s.children(n.id) {
+		s.remove(c)
+	}
+	delete(s.items, n.id)
+}
+
+// copyTree copies n and everything below it. The caller must hold s.mu.
+func (s *Server) copyTree(n *node, parentID, name string) *node {
+	c := s.create(n.typ, parentID, name, append([]byte(nil), n.content...))
+	for _, child := range s.children(n.id) {
+		if child.id != c.id {
+			s.copyTree(child, c.id, child.name)
+		}
+	}
+	return c
+}
+
+// checkLength rejects an upload sent without a Content-Length.
+func (s *Server) checkLength(w http.ResponseWriter, r *http.Request) bool {
+	if r.ContentLength < 0 {
+		s.writeError(w, http.StatusLengthRequired, "length_required", "Uploads must have a Content-Length", nil)
+		return false
+	}
+	return true
+}
+
+// uploadFile implements POST /files/content on the upload host.
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request) {
+	if !s.checkLength(w, r) {
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Invalid multipart body: "+err.Error(), nil)
+		return
+	}
+	var attrs struct {
+		target
+		ContentCreatedAt  string `json:"content_created_at"`
+		ContentModifiedAt string `json:"content_modified_at"`
+	}
+	if err := json.Unmarshal([]byte(r.FormValue("attributes")), &attrs); err != nil {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Invalid attributes: "+err.Error(), nil)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Missing file part", nil)
+		return
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Unreadable file part", nil)
+		return
+	}
+
+	// Box takes the SHA1 of the content in the Content-MD5 header.
+	if sum := r.Header.Get("Content-MD5"); sum != "" && sum != (&node{content: content}).sha1() {
+		s.writeError(w, http.StatusPreconditionFailed, "sha1_mismatch", "The SHA1 of the content does not match", nil)
+		return
+	}
+	if attrs.Name == "" {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Missing file name", nil)
+		return
+	}
+	if s.conflict(w, attrs.Parent.ID, attrs.Name, false) || s.denied(w, attrs.Parent.ID, len(content)) {
+		return
+	}
+	n := s.create("file", attrs.Parent.ID, attrs.Name, content)
+	n.contentCreated = attrs.ContentCreatedAt
+	n.contentModified = attrs.ContentModifiedAt
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"total_count": 1,
+		"entries":     []interface{}{s.full(n)},
+	})
+}
+
+// uploadVersion replaces the content of a file with a new version.
+func (s *Server) uploadVersion(w http.ResponseWriter, r *http.Request, fileID string) {
+	n := s.find(w, "file", fileID)
+	if n == nil || !s.checkEtag(w, r, n) || !s.checkLength(w, r) {
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Invalid multipart body: "+err.Error(), nil)
+		return
+	}
+	var attrs struct {
+		Name              string `json:"name"`
+		ContentModifiedAt string `json:"content_modified_at"`
+	}
+	if v := r.FormValue("attributes"); v != "" {
+		if err := json.Unmarshal([]byte(v), &attrs); err != nil {
+			s.writeError(w, http.StatusBadRequest, "bad_request", "Invalid attributes: "+err.Error(), nil)
+			return
+		}
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Missing file part", nil)
+		return
+	}
+	defer file.Close()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Unreadable file part", nil)
+		return
+	}
+
+	if sum := r.Header.Get("Content-MD5"); sum != "" && sum != (&node{content: content}).sha1() {
+		s.writeError(w, http.StatusPreconditionFailed, "sha1_mismatch", "The SHA1 of the content does not match", nil)
+		return
+	}
+	if attrs.Name != "" && attrs.Name != n.name && s.conflict(w, n.parent, attrs.Name, false) {
+		return
+	}
+	s.replace(n, content)
+	if attrs.Name != "" {
+		n.name = attrs.Name
+	}
+	n.contentModified = attrs.ContentModifiedAt
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"total_count": 1,
+		"entries":     []interface{}{s.full(n)},
+	})
+}
+
+// preflight checks whether an upload would be accepted.
+func (s *Server) preflight(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		target
+		Size int `json:"size"`
+	}
+	if !s.decode(w, r, &req) {
+		return
+	}
+	if s.conflict(w, req.Parent.ID, req.Name, false) || s.denied(w, req.Parent.ID, req.Size) {
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]string{
+		"upload_url":   s.UploadURL() + "/files/content",
+		"upload_token": "",
+	})
+}
+
+// denied rejects uploads of size bytes to a read-only folder or beyond the
+// quota.
+func (s *Server) denied(w http.ResponseWriter, folderID string, size int) bool {
+	if s.readOnly[folderID] {
+		s.writeError(w, http.StatusForbidden, "access_denied_insufficient_permissions",
+			"Access denied - insufficient permission", nil)
+		return true
+	}
+	if s.Quota > 0 {
+		used := 0
+		for _, n := range s.items {
+			used += len(n.content)
+		}
+		if used+size > s.Quota {
+			s.writeError(w, http.StatusForbidden, "storage_limit_exceeded", "Account storage limit reached", nil)
+			return true
+		}
+	}
+	return false
+}
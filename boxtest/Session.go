@@ -0,0 +1,329 @@
+package boxtest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultPartSize is the part size of upload sessions when Server.PartSize
+// is not set.
+const defaultPartSize = 8 << 20
+
+// session is a chunked upload session. Exactly one of folderID and fileID is
+// set, for a new file or a new version respectively.
+type session struct {
+	id       string
+	folderID string
+	fileID   string
+	name     string
+	size     int64
+	partSize int64
+	parts    map[int64]*sessionPart
+	created  time.Time
+}
+
+// sessionPart is a part uploaded to a session.
+type sessionPart struct {
+	id      string
+	offset  int64
+	content []byte
+}
+
+func (p *sessionPart) render() map[string]interface{} {
+	sum := sha1.Sum(p.content)
+	return map[string]interface{}{
+		"part_id": p.id,
+		"offset":  p.offset,
+		"size":    len(p.content),
+		"sha1":    hex.EncodeToString(sum[:]),
+	}
+}
+
+// PeakParts returns the largest number of part uploads the fake has had in
+// flight at once.
+func (s *Server) PeakParts() int {
+	s.partMu.Lock()
+	defer s.partMu.Unlock()
+	return s.partsPeak
+}
+
+// partStarted counts a part upload in flight.
+func (s *Server) partStarted() {
+	s.partMu.Lock()
+	defer s.partMu.Unlock()
+	s.partsActive++
+	if s.partsActive > s.partsPeak {
+		s.partsPeak = s.partsActive
+	}
+}
+
+// partDone counts a part upload as finished.
+func (s *Server) partDone() {
+	s.partMu.Lock()
+	defer s.partMu.Unlock()
+	s.partsActive--
+}
+
+// DeferNextCommits makes the next n commits of upload sessions answer 202
+// Accepted, as Box does while it is still processing the parts.
+func (s *Server) DeferNextCommits(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deferred = n
+}
+
+// Sessions returns the number of open upload sessions.
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// renderSession returns the upload session object for ss.
+func (s *Server) renderSession(ss *session) map[string]interface{} {
+	base := s.URL + "/api/2.0/files/upload_sessions/" + ss.id
+	return map[string]interface{}{
+		"type":                "upload_session",
+		"id":                  ss.id,
+		"session_expires_at":  ss.created.Add(7 * 24 * time.Hour).Format(time.RFC3339),
+		"part_size":           ss.partSize,
+		"total_parts":         (ss.size + ss.partSize - 1) / ss.partSize,
+		"num_parts_processed": len(ss.parts),
+		"session_endpoints": map[string]string{
+			"upload_part": base,
+			"commit":      base + "/commit",
+			"abort":       base,
+			"list_parts":  base + "/parts",
+			"status":      base,
+		},
+	}
+}
+
+// createSession starts an upload session for a new file, or for a new
+// version of the file with the given ID.
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request, fileID string) {
+	var req struct {
+		FolderID string `json:"folder_id"`
+		FileSize int64  `json:"file_size"`
+		FileName string `json:"file_name"`
+	}
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	ss := &session{
+		name:    req.FileName,
+		size:    req.FileSize,
+		parts:   make(map[int64]*sessionPart),
+		created: time.Now().UTC(),
+	}
+	if fileID != "" {
+		n := s.find(w, "file", fileID)
+		if n == nil {
+			return
+		}
+		ss.fileID = fileID
+		if ss.name == "" {
+			ss.name = n.name
+		}
+	} else {
+		if ss.name == "" {
+			s.writeError(w, http.StatusBadRequest, "bad_request", "Missing file name", nil)
+			return
+		}
+		if s.conflict(w, req.FolderID, req.FileName, false) {
+			return
+		}
+		ss.folderID = req.FolderID
+	}
+	if req.FileSize <= 0 {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Invalid file size", nil)
+		return
+	}
+
+	ss.partSize = int64(s.PartSize)
+	if ss.partSize <= 0 {
+		ss.partSize = defaultPartSize
+	}
+	s.nextID++
+	ss.id = "S" + strconv.Itoa(s.nextID)
+	s.sessions[ss.id] = ss
+	s.writeJSON(w, http.StatusCreated, s.renderSession(ss))
+}
+
+// uploadSessions implements the /files/upload_sessions endpoints.
+func (s *Server) uploadSessions(w http.ResponseWriter, r *http.Request, seg []string) {
+	if len(seg) == 0 || seg[0] == "" {
+		if r.Method == http.MethodPost {
+			s.createSession(w, r, "")
+			return
+		}
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed", nil)
+		return
+	}
+
+	ss, ok := s.sessions[seg[0]]
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "not_found", "Upload session not found", nil)
+		return
+	}
+
+	switch {
+	case len(seg) == 1 && r.Method == http.MethodGet:
+		s.writeJSON(w, http.StatusOK, s.renderSession(ss))
+	case len(seg) == 1 && r.Method == http.MethodPut:
+		s.uploadPart(w, r, ss)
+	case len(seg) == 1 && r.Method == http.MethodDelete:
+		delete(s.sessions, ss.id)
+		w.WriteHeader(http.StatusNoContent)
+	case len(seg) == 2 && seg[1] == "parts" && r.Method == http.MethodGet:
+		s.listParts(w, r, ss)
+	case len(seg) == 2 && seg[1] == "commit" && r.Method == http.MethodPost:
+		s.commit(w, r, ss)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed", nil)
+	}
+}
+
+// digest returns the Digest header value for content.
+func digest(content []byte) string {
+	sum := sha1.Sum(content)
+	return "sha=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// uploadPart stores a part of a session's file.
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, ss *session) {
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Unreadable body", nil)
+		return
+	}
+
+	var start, end, total int64
+	_, err = fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+	switch {
+	case err != nil || total != ss.size || start%ss.partSize != 0 || end < start || end >= total:
+		s.writeError(w, http.StatusRequestedRangeNotSatisfiable, "range_mismatch", "Invalid Content-Range", nil)
+		return
+	case r.ContentLength != end-start+1:
+		s.writeError(w, http.StatusLengthRequired, "length_required", "Content-Length must match the part", nil)
+		return
+	case int64(len(content)) != end-start+1 || (end-start+1 != ss.partSize && end != total-1):
+		s.writeError(w, http.StatusRequestedRangeNotSatisfiable, "range_mismatch", "Part size does not match the session", nil)
+		return
+	case r.Header.Get("Digest") != digest(content):
+		s.writeError(w, http.StatusPreconditionFailed, "sha1_mismatch", "Digest does not match the part", nil)
+		return
+	}
+
+	sum := sha1.Sum(content)
+	p := &sessionPart{id: fmt.Sprintf("%08X", sum[:4]), offset: start, content: content}
+	ss.parts[start] = p
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"part": p.render()})
+}
+
+// sortedParts returns the parts of a session in file order.
+func (ss *session) sortedParts() []*sessionPart {
+	parts := make([]*sessionPart, 0, len(ss.parts))
+	for _, p := range ss.parts {
+		parts = append(parts, p)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].offset < parts[j].offset })
+	return parts
+}
+
+// listParts lists the parts uploaded to a session.
+func (s *Server) listParts(w http.ResponseWriter, r *http.Request, ss *session) {
+	parts := ss.sortedParts()
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	entries := []interface{}{}
+	for i := offset; i < len(parts) && i < offset+limit; i++ {
+		entries = append(entries, parts[i].render())
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"entries":     entries,
+		"offset":      offset,
+		"limit":       limit,
+		"total_count": len(parts),
+	})
+}
+
+// commit assembles the parts of a session into a file.
+func (s *Server) commit(w http.ResponseWriter, r *http.Request, ss *session) {
+	var req struct {
+		Parts []struct {
+			PartID string `json:"part_id"`
+			Offset int64  `json:"offset"`
+		} `json:"parts"`
+		Attributes struct {
+			ContentModifiedAt string `json:"content_modified_at"`
+		} `json:"attributes"`
+	}
+	if !s.decode(w, r, &req) {
+		return
+	}
+	if s.deferred > 0 {
+		s.deferred--
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	parts := ss.sortedParts()
+	if len(req.Parts) != len(parts) {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Parts do not match the session", nil)
+		return
+	}
+	var content bytes.Buffer
+	for i, p := range parts {
+		if req.Parts[i].PartID != p.id || req.Parts[i].Offset != p.offset || p.offset != int64(content.Len()) {
+			s.writeError(w, http.StatusBadRequest, "bad_request", "Parts do not match the session", nil)
+			return
+		}
+		content.Write(p.content)
+	}
+	if int64(content.Len()) != ss.size {
+		s.writeError(w, http.StatusBadRequest, "bad_request", "Parts do not cover the file", nil)
+		return
+	}
+	if r.Header.Get("Digest") != digest(content.Bytes()) {
+		s.writeError(w, http.StatusPreconditionFailed, "sha1_mismatch", "Digest does not match the file", nil)
+		return
+	}
+
+	var n *node
+	if ss.fileID != "" {
+		if n = s.find(w, "file", ss.fileID); n == nil {
+			return
+		}
+		if !s.checkEtag(w, r, n) {
+			return
+		}
+		s.replace(n, content.Bytes())
+		n.name = ss.name
+	} else {
+		if s.conflict(w, ss.folderID, ss.name, false) {
+			return
+		}
+		n = s.create("file", ss.folderID, ss.name, content.Bytes())
+	}
+	n.contentModified = req.Attributes.ContentModifiedAt
+	delete(s.sessions, ss.id)
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"total_count": 1,
+		"entries":     []interface{}{s.full(n)},
+	})
+}
@@ -0,0 +1,86 @@
+package boxtest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// update applies a PUT /files/{id} or /folders/{id} request to n.
+func (s *Server) update(w http.ResponseWriter, r *http.Request, n *node) {
+	if !s.checkEtag(w, r, n) {
+		return
+	}
+	var req map[string]interface{}
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	name, _ := req["name"].(string)
+	if name == "" {
+		name = n.name
+	}
+	parentID := n.parent
+	if parent, ok := req["parent"].(map[string]interface{}); ok {
+		parentID, _ = parent["id"].(string)
+	}
+	if name != n.name || parentID != n.parent {
+		if existing := s.lookup(parentID, name); existing != n &&
+			s.conflict(w, parentID, name, n.typ == "folder") {
+			return
+		}
+		for p := s.items[parentID]; n.typ == "folder" && p != nil; p = s.items[p.parent] {
+			if p == n {
+				s.writeError(w, http.StatusBadRequest, "bad_request", "Cannot move a folder into itself", nil)
+				return
+			}
+			if p.id == RootID {
+				break
+			}
+		}
+		n.name, n.parent = name, parentID
+	}
+
+	if email, ok := req["folder_upload_email"].(map[string]interface{}); ok {
+		email["email"] = "upload." + n.id + "@u.box.com"
+	}
+	if n.extra == nil {
+		n.extra = make(map[string]interface{})
+	}
+	for _, field := range []string{
+		"description", "tags", "disposition_at", "collections", "folder_upload_email",
+		"sync_state", "can_non_owners_invite", "is_collaboration_restricted_to_enterprise",
+	} {
+		if v, ok := req[field]; ok && v != nil {
+			n.extra[field] = v
+		} else if ok {
+			delete(n.extra, field)
+		}
+	}
+	if v, ok := req["lock"]; ok {
+		if lock, ok := v.(map[string]interface{}); ok {
+			s.nextID++
+			n.extra["lock"] = map[string]interface{}{
+				"type":                  "lock",
+				"id":                    strconv.Itoa(s.nextID),
+				"created_at":            time.Now().UTC().Format(time.RFC3339),
+				"expires_at":            lock["expires_at"],
+				"is_download_prevented": lock["is_download_prevented"],
+			}
+		} else {
+			delete(n.extra, "lock")
+		}
+	}
+	if v, ok := req["shared_link"]; ok {
+		if link, ok := v.(map[string]interface{}); ok {
+			link["url"] = s.URL + "/s/" + n.id
+			n.extra["shared_link"] = link
+		} else {
+			delete(n.extra, "shared_link")
+		}
+	}
+
+	n.etag++
+	n.modified = time.Now().UTC()
+	s.writeJSON(w, http.StatusOK, s.full(n))
+}
@@ -0,0 +1,115 @@
+package boxtest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// renderVersion renders a previous version of a file.
+func renderVersion(v *fileVersion) map[string]interface{} {
+	sum := sha1.Sum(v.content)
+	m := map[string]interface{}{
+		"type":        "file_version",
+		"id":          v.id,
+		"sha1":        hex.EncodeToString(sum[:]),
+		"name":        v.name,
+		"size":        len(v.content),
+		"created_at":  v.created.Format(time.RFC3339),
+		"modified_at": v.created.Format(time.RFC3339),
+	}
+	if !v.trashed.IsZero() {
+		m["trashed_at"] = v.trashed.Format(time.RFC3339)
+	}
+	if !v.restored.IsZero() {
+		m["restored_at"] = v.restored.Format(time.RFC3339)
+	}
+	return m
+}
+
+// current returns the current version of n as a file version.
+func current(n *node) *fileVersion {
+	return &fileVersion{id: n.version, name: n.name, content: n.content, created: n.modified}
+}
+
+// findVersion looks up a version of n, writing a 404 if it does not exist.
+func (s *Server) findVersion(w http.ResponseWriter, n *node, versionID string) *fileVersion {
+	if versionID == n.version {
+		return current(n)
+	}
+	for _, v := range n.versions {
+		if v.id == versionID {
+			return v
+		}
+	}
+	s.writeError(w, http.StatusNotFound, "not_found", "Version not found", nil)
+	return nil
+}
+
+// fileVersions implements the /files/{id}/versions endpoints.
+func (s *Server) fileVersions(w http.ResponseWriter, r *http.Request, n *node, seg []string) {
+	switch {
+	case len(seg) == 0 && r.Method == http.MethodGet:
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 1000
+		}
+		entries := []interface{}{}
+		for i := len(n.versions) - 1 - offset; i >= 0 && len(entries) < limit; i-- {
+			entries = append(entries, renderVersion(n.versions[i]))
+		}
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"total_count": len(n.versions),
+			"entries":     entries,
+			"offset":      offset,
+			"limit":       limit,
+		})
+	case len(seg) == 1 && seg[0] == "current" && r.Method == http.MethodPost:
+		var req struct {
+			ID string `json:"id"`
+		}
+		if !s.decode(w, r, &req) {
+			return
+		}
+		v := s.findVersion(w, n, req.ID)
+		if v == nil {
+			return
+		}
+		s.replace(n, v.content)
+		s.writeJSON(w, http.StatusCreated, renderVersion(current(n)))
+	case len(seg) == 1 && r.Method == http.MethodGet:
+		if v := s.findVersion(w, n, seg[0]); v != nil {
+			s.writeJSON(w, http.StatusOK, renderVersion(v))
+		}
+	case len(seg) == 1 && r.Method == http.MethodDelete:
+		if seg[0] == n.version {
+			s.writeError(w, http.StatusBadRequest, "bad_request", "The current version cannot be deleted", nil)
+			return
+		}
+		v := s.findVersion(w, n, seg[0])
+		if v == nil || !s.checkEtag(w, r, n) {
+			return
+		}
+		v.trashed = time.Now().UTC()
+		w.WriteHeader(http.StatusNoContent)
+	case len(seg) == 1 && r.Method == http.MethodPut:
+		var req map[string]interface{}
+		if !s.decode(w, r, &req) {
+			return
+		}
+		v := s.findVersion(w, n, seg[0])
+		if v == nil {
+			return
+		}
+		if trashedAt, ok := req["trashed_at"]; ok && trashedAt == nil && !v.trashed.IsZero() {
+			v.trashed = time.Time{}
+			v.restored = time.Now().UTC()
+		}
+		s.writeJSON(w, http.StatusOK, renderVersion(v))
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed", nil)
+	}
+}